@@ -0,0 +1,288 @@
+package qap
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BreakdownRow is an entry of an equipment breakdown file. The level of the
+// node in the project structure is inferred from the length of Code, i.e.
+// "M" is a system, "MV" a family and "MVR" a type.
+type BreakdownRow struct {
+	// Line is the line of the file the row was read from. It is zero
+	// for rows not read from a file.
+	Line        int
+	Code        string
+	Name        string
+	Description string
+}
+
+// BreakdownIssue is a problem found in a breakdown file or while importing it.
+type BreakdownIssue struct {
+	Line int
+	Code string
+	Msg  string
+}
+
+func (bi BreakdownIssue) Error() string {
+	if bi.Code == "" {
+		return fmt.Sprintf("line %d: %s", bi.Line, bi.Msg)
+	}
+	return fmt.Sprintf("line %d: %s: %s", bi.Line, bi.Code, bi.Msg)
+}
+
+// Breakdown returns the nodes of the project structure as breakdown rows in
+// the order they are visited by Walk, which places parents before their children,
+// followed by the serial ranges with their pattern as code. See ParseSerialRange.
+func (p Project) Breakdown() []BreakdownRow {
+	var rows []BreakdownRow
+	p.Walk(func(n Node) error {
+		rows = append(rows, BreakdownRow{Code: n.Code, Name: n.Name, Description: n.Description})
+		return nil
+	})
+	for _, sr := range p.Serials {
+		rows = append(rows, BreakdownRow{Code: sr.Pattern(), Name: sr.Name, Description: sr.Description})
+	}
+	return rows
+}
+
+// ImportBreakdown adds the rows to the project structure. Rows may be in any
+// order, parents are added before their children. Rows with malformed codes,
+// codes that appear more than once or are already in the structure and rows
+// whose parent is neither in the structure nor in rows are reported as issues.
+// The structure is only modified if there are no issues.
+func (p *Project) ImportBreakdown(rows []BreakdownRow) []BreakdownIssue {
+	var issues []BreakdownIssue
+	issue := func(row BreakdownRow, format string, args ...any) {
+		issues = append(issues, BreakdownIssue{Line: row.Line, Code: row.Code, Msg: fmt.Sprintf(format, args...)})
+	}
+	lines := make(map[string]int, len(rows))
+	// parents holds the code of the node each row is added under.
+	parents := make(map[string]string, len(rows))
+	for _, row := range rows {
+		if isSerialPattern(row.Code) {
+			sr, err := ParseSerialRange(row.Code)
+			if err != nil {
+				issue(row, "%s", err)
+				continue
+			}
+			parents[row.Code] = sr.Prefix
+		} else if len(row.Code) == 0 || len(row.Code) > lenE || validQAPAlphanum([]byte(row.Code)) != row.Code {
+			issue(row, "equipment code must be 1 to %d uppercase letters or digits", lenE)
+			continue
+		} else if len(row.Code) > 1 {
+			parents[row.Code] = row.Code[:len(row.Code)-1]
+		}
+		if line, ok := lines[row.Code]; ok {
+			issue(row, "duplicate of line %d", line)
+			continue
+		}
+		lines[row.Code] = row.Line
+		if _, err := p.node(row.Code); err == nil {
+			issue(row, "already in project structure")
+		}
+	}
+	for _, row := range rows {
+		parent := parents[row.Code]
+		if line, ok := lines[row.Code]; !ok || line != row.Line || parent == "" {
+			continue // Malformed, duplicate or system.
+		}
+		if _, inFile := lines[parent]; !inFile {
+			if _, err := p.node(parent); err != nil {
+				issue(row, "orphan, parent %s is not in file or project structure", parent)
+			}
+		}
+	}
+	if len(issues) > 0 {
+		sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+		return issues
+	}
+	sorted := append([]BreakdownRow{}, rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		// Serial ranges are added in order after the nodes they are numbered under.
+		si, sj := isSerialPattern(sorted[i].Code), isSerialPattern(sorted[j].Code)
+		if si || sj {
+			return !si && sj
+		}
+		return len(sorted[i].Code) < len(sorted[j].Code)
+	})
+	// Rows are added to a copy so that the structure is left
+	// untouched should an unforeseen error occur.
+	imported := p.clone()
+	for _, row := range sorted {
+		if err := imported.AddEquipmentCode(row.Code, row.Name, row.Description); err != nil {
+			issue(row, "%s", err)
+			return issues
+		}
+	}
+	*p = imported
+	return nil
+}
+
+// clone returns a copy of the project whose equipment structure
+// does not share memory with the original.
+func (p Project) clone() Project {
+	cp := p
+	cp.Systems = append([]System(nil), p.Systems...)
+	for i := range cp.Systems {
+		sys := &cp.Systems[i]
+		sys.Families = append([]Family(nil), sys.Families...)
+		for j := range sys.Families {
+			fam := &sys.Families[j]
+			fam.Types = append([]Type(nil), fam.Types...)
+			for k := range fam.Types {
+				typ := &fam.Types[k]
+				typ.Models = append([]Model(nil), typ.Models...)
+				for l := range typ.Models {
+					typ.Models[l].Variants = append([]Variant(nil), typ.Models[l].Variants...)
+				}
+			}
+		}
+	}
+	cp.DocumentTypes = append([]DocumentType(nil), p.DocumentTypes...)
+	cp.DocumentTypeRules = append([]DocumentTypeRule(nil), p.DocumentTypeRules...)
+	for i := range cp.DocumentTypeRules {
+		cp.DocumentTypeRules[i].Allowed = append([]string(nil), cp.DocumentTypeRules[i].Allowed...)
+	}
+	cp.Serials = append([]SerialRange(nil), p.Serials...)
+	return cp
+}
+
+// breakdownHeader is the optional first record of a breakdown CSV file.
+var breakdownHeader = []string{"code", "name", "description"}
+
+// ReadBreakdownCSV reads "code,name,description" records from r. The
+// description field is optional and a first record equal to
+// "code,name,description" is skipped.
+func ReadBreakdownCSV(r io.Reader) ([]BreakdownRow, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+	c.TrimLeadingSpace = true
+	var rows []BreakdownRow
+	for first := true; ; first = false {
+		record, err := c.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return rows, err
+		}
+		line, _ := c.FieldPos(0)
+		if first && isBreakdownHeader(record) {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return rows, BreakdownIssue{Line: line, Msg: fmt.Sprintf("expected 2 or 3 fields, got %d", len(record))}
+		}
+		row := BreakdownRow{Line: line, Code: strings.TrimSpace(record[0]), Name: strings.TrimSpace(record[1])}
+		if len(record) == 3 {
+			row.Description = strings.TrimSpace(record[2])
+		}
+		rows = append(rows, row)
+	}
+}
+
+func isBreakdownHeader(record []string) bool {
+	if len(record) < 2 || len(record) > len(breakdownHeader) {
+		return false
+	}
+	for i := range record {
+		if !strings.EqualFold(strings.TrimSpace(record[i]), breakdownHeader[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteBreakdownCSV writes rows to w as "code,name,description" records
+// preceded by a header record. See ReadBreakdownCSV.
+func WriteBreakdownCSV(w io.Writer, rows []BreakdownRow) error {
+	c := csv.NewWriter(w)
+	c.Write(breakdownHeader)
+	for _, row := range rows {
+		c.Write([]string{row.Code, row.Name, row.Description})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// ReadBreakdownYAML reads a breakdown from the subset of YAML written by
+// WriteBreakdownYAML, a sequence of mappings with code, name and description keys:
+//
+//	# Comments and blank lines are ignored.
+//	- code: M
+//	  name: Engines
+//	  description: "Rocket engines, \"quoted\" strings are unescaped."
+//	- code: MV
+//	  name: Vacuum
+func ReadBreakdownYAML(r io.Reader) ([]BreakdownRow, error) {
+	var rows []BreakdownRow
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimRight(s.Text(), " \t\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "- ") {
+			rows = append(rows, BreakdownRow{Line: line})
+			text = text[2:]
+		} else if !strings.HasPrefix(text, "  ") || len(rows) == 0 {
+			return rows, BreakdownIssue{Line: line, Msg: "expected sequence item starting with \"- \" or indented key"}
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(text), ":")
+		if !ok {
+			return rows, BreakdownIssue{Line: line, Msg: "expected \"key: value\""}
+		}
+		value, err := unquoteYAML(strings.TrimSpace(value))
+		if err != nil {
+			return rows, BreakdownIssue{Line: line, Msg: err.Error()}
+		}
+		row := &rows[len(rows)-1]
+		switch key {
+		case "code":
+			row.Code = value
+		case "name":
+			row.Name = value
+		case "description":
+			row.Description = value
+		default:
+			return rows, BreakdownIssue{Line: line, Msg: fmt.Sprintf("unknown key %q", key)}
+		}
+	}
+	return rows, s.Err()
+}
+
+// unquoteYAML returns the value of a plain, single or double quoted YAML scalar.
+func unquoteYAML(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", errors.New("unterminated single quoted string")
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// WriteBreakdownYAML writes rows to w in the format read by ReadBreakdownYAML.
+func WriteBreakdownYAML(w io.Writer, rows []BreakdownRow) error {
+	bw := bufio.NewWriter(w)
+	for _, row := range rows {
+		fmt.Fprintf(bw, "- code: %s\n  name: %s\n", row.Code, strconv.Quote(row.Name))
+		if row.Description != "" {
+			fmt.Fprintf(bw, "  description: %s\n", strconv.Quote(row.Description))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,148 @@
+package qap
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportBreakdown(t *testing.T) {
+	const csvFile = `Code,Name,Description
+MVR,Raptor,"Raptor engine, vacuum"
+M,Engines,Rocket engines
+MV,Vacuum
+XA,Orphan,No system X
+MV,Twice,Duplicate family
+mb,Lower,Malformed code
+`
+	rows, err := ReadBreakdownCSV(strings.NewReader(csvFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 || rows[0] != (BreakdownRow{Line: 2, Code: "MVR", Name: "Raptor", Description: "Raptor engine, vacuum"}) {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	issues := p.ImportBreakdown(rows)
+	var lines []int
+	for _, issue := range issues {
+		lines = append(lines, issue.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{5, 6, 7}) {
+		t.Errorf("expected issues at lines 5, 6 and 7, got %v", issues)
+	}
+	if len(p.Systems) != 0 {
+		t.Error("structure modified by import with issues")
+	}
+	issues = p.ImportBreakdown(rows[:3])
+	if len(issues) != 0 {
+		t.Fatal(issues)
+	}
+	nodes, err := p.Resolve("MVR")
+	if err != nil || NodePath(nodes) != "Engines > Vacuum > Raptor" {
+		t.Errorf("got path %q, err %v", NodePath(nodes), err)
+	}
+	issues = p.ImportBreakdown([]BreakdownRow{{Line: 1, Code: "MVRA", Name: "A"}, {Line: 2, Code: "MV", Name: "Again"}})
+	if len(issues) != 1 || issues[0].Code != "MV" {
+		t.Errorf("expected existing family issue, got %v", issues)
+	}
+}
+
+func TestProjectClone(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MVRA", "MVRA1", "MB", "MVR[01-50]"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.RestrictDocumentTypes("M", "DR"); err != nil {
+		t.Fatal(err)
+	}
+	cp := p.clone()
+	if !reflect.DeepEqual(cp, p) {
+		t.Fatalf("clone differs from original")
+	}
+	cp.Systems[0].Families[0].Types[0].Models[0].Variants[0].Name = "changed"
+	cp.Systems[0].Families[1].Name = "changed"
+	cp.DocumentTypeRules[0].Allowed[0] = "QA"
+	cp.Serials[0].Name = "changed"
+	if changes := DiffProjects(p, cp); len(changes) != 3 {
+		t.Errorf("expected 3 renamed nodes in clone, got %v", changes)
+	}
+	if p.Systems[0].Families[0].Types[0].Models[0].Variants[0].Name != "name" || p.Systems[0].Families[1].Name != "name" ||
+		p.DocumentTypeRules[0].Allowed[0] != "DR" || p.Serials[0].Name != "name" {
+		t.Error("original modified through clone")
+	}
+}
+
+func TestBreakdownRoundTrip(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MVRA", "MVRAB", "X"} {
+		if err := p.AddEquipmentCode(code, "name "+code, `a "quoted" description: #`+code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := p.Breakdown()
+	for _, format := range []struct {
+		name  string
+		write func(*bytes.Buffer, []BreakdownRow) error
+		read  func(*bytes.Buffer) ([]BreakdownRow, error)
+	}{
+		{
+			name:  "csv",
+			write: func(b *bytes.Buffer, rows []BreakdownRow) error { return WriteBreakdownCSV(b, rows) },
+			read:  func(b *bytes.Buffer) ([]BreakdownRow, error) { return ReadBreakdownCSV(b) },
+		},
+		{
+			name:  "yaml",
+			write: func(b *bytes.Buffer, rows []BreakdownRow) error { return WriteBreakdownYAML(b, rows) },
+			read:  func(b *bytes.Buffer) ([]BreakdownRow, error) { return ReadBreakdownYAML(b) },
+		},
+	} {
+		var buf bytes.Buffer
+		if err := format.write(&buf, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := format.read(&buf)
+		if err != nil {
+			t.Fatal(format.name, err)
+		}
+		imported := Project{Code: p.Code}
+		if issues := imported.ImportBreakdown(got); len(issues) != 0 {
+			t.Fatal(format.name, issues)
+		}
+		if !reflect.DeepEqual(imported.Breakdown(), want) {
+			t.Errorf("%s: round trip mismatch\n%+v\n%+v", format.name, imported.Breakdown(), want)
+		}
+	}
+}
+
+func TestReadBreakdownYAML(t *testing.T) {
+	const yamlFile = `# Engines breakdown
+---
+- code: M
+  name: Engines # trailing comment
+  description: 'It''s rocket science'
+
+- code: MV
+  name: "Vacuum"
+`
+	rows, err := ReadBreakdownYAML(strings.NewReader(yamlFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BreakdownRow{
+		{Line: 3, Code: "M", Name: "Engines", Description: "It's rocket science"},
+		{Line: 7, Code: "MV", Name: "Vacuum"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+	for _, bad := range []string{"code: M\n", "- code: M\n  label: x\n", "- code: M\n  name: \"unterminated\n", "- code M\n"} {
+		_, err := ReadBreakdownYAML(strings.NewReader(bad))
+		if _, ok := err.(BreakdownIssue); !ok {
+			t.Errorf("%q: expected BreakdownIssue error, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/soypat/go-qap"
+)
+
+type decision string
+
+const (
+	decisionPending  decision = ""
+	decisionApproved decision = "approved"
+	decisionRejected decision = "rejected"
+)
+
+// approval is a reviewer's decision on a revision submitted for approval.
+// Approvals are stored DB side with the revision.
+type approval struct {
+	Reviewer string
+	// Round is the submission the approval belongs to. Revisions
+	// which are rejected and resubmitted start a new round.
+	Round    int
+	Decision decision `json:",omitempty"`
+	Comment  string   `json:",omitempty"`
+	Time     time.Time
+}
+
+func (a approval) Pending() bool { return a.Decision == decisionPending }
+
+func (a approval) String() string {
+	if a.Pending() {
+		return a.Reviewer + ": pending"
+	}
+	return a.Reviewer + ": " + string(a.Decision)
+}
+
+// round returns the latest approval round of the revision.
+func (r revision) round() int {
+	round := 0
+	for _, a := range r.Approvals {
+		if a.Round > round {
+			round = a.Round
+		}
+	}
+	return round
+}
+
+// CurrentApprovals returns the approvals of the latest submission of the revision.
+func (r revision) CurrentApprovals() []approval {
+	round := r.round()
+	var current []approval
+	for _, a := range r.Approvals {
+		if a.Round == round && round != 0 {
+			current = append(current, a)
+		}
+	}
+	return current
+}
+
+// CanSubmit reports whether the latest revision of the document may be submitted for approval.
+func (d document) CanSubmit() bool {
+	return d.State().CanTransition(qap.StateUnderApproval)
+}
+
+// PendingReviewers returns the reviewers which have not yet reviewed
+// the latest revision of the document.
+func (d document) PendingReviewers() []string {
+	if len(d.Revisions) == 0 || d.State() != qap.StateUnderApproval {
+		return nil
+	}
+	var pending []string
+	for _, a := range d.Revisions[len(d.Revisions)-1].CurrentApprovals() {
+		if a.Pending() {
+			pending = append(pending, a.Reviewer)
+		}
+	}
+	return pending
+}
+
+// transition changes the lifecycle state of the latest revision of the document.
+func (d *document) transition(to qap.State) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	info, err = info.Transition(to)
+	if err != nil {
+		return err
+	}
+	if len(d.Revisions) == 0 {
+		d.Revisions = []revision{{Index: d.Revision()}}
+	}
+	latest := &d.Revisions[len(d.Revisions)-1]
+	latest.Index = info.Revision
+	latest.State = info.State
+	return nil
+}
+
+// submit submits the latest revision of the document for approval by reviewers.
+func (d *document) submit(reviewers []string, now time.Time) error {
+	var names []string
+	seen := make(map[string]bool)
+	for _, reviewer := range reviewers {
+		reviewer = strings.TrimSpace(reviewer)
+		if reviewer == "" || seen[strings.ToLower(reviewer)] {
+			continue
+		}
+		seen[strings.ToLower(reviewer)] = true
+		names = append(names, reviewer)
+	}
+	if len(names) == 0 {
+		return errors.New("no reviewers for approval")
+	}
+	err := d.transition(qap.StateUnderApproval)
+	if err != nil {
+		return err
+	}
+	latest := &d.Revisions[len(d.Revisions)-1]
+	round := latest.round() + 1
+	for _, name := range names {
+		latest.Approvals = append(latest.Approvals, approval{Reviewer: name, Round: round, Time: now})
+	}
+	return nil
+}
+
+// review records the decision of reviewer on the latest revision of the document.
+// If all reviewers approved the revision it is released. If the reviewer rejects
+// the revision it returns to In Work and a comment is required.
+func (d *document) review(reviewer string, approve bool, comment string, now time.Time) error {
+	if d.State() != qap.StateUnderApproval {
+		return fmt.Errorf("revision %s is not under approval", d.Revision())
+	}
+	comment = strings.TrimSpace(comment)
+	if !approve && comment == "" {
+		return errors.New("rejection requires a comment")
+	}
+	latest := &d.Revisions[len(d.Revisions)-1]
+	round := latest.round()
+	idx := -1
+	for i, a := range latest.Approvals {
+		if a.Round == round && strings.EqualFold(a.Reviewer, strings.TrimSpace(reviewer)) {
+			idx = i
+			break
+		}
+	}
+	switch {
+	case idx < 0:
+		return fmt.Errorf("%q is not a reviewer of revision %s", reviewer, d.Revision())
+	case !latest.Approvals[idx].Pending():
+		return fmt.Errorf("%q already reviewed revision %s", reviewer, d.Revision())
+	}
+	a := &latest.Approvals[idx]
+	a.Comment = comment
+	a.Time = now
+	if !approve {
+		a.Decision = decisionRejected
+		return d.transition(qap.StateInWork)
+	}
+	a.Decision = decisionApproved
+	for _, a := range latest.CurrentApprovals() {
+		if a.Decision != decisionApproved {
+			return nil
+		}
+	}
+	return d.transition(qap.StateReleased)
+}
@@ -18,6 +18,9 @@ import (
 // ErrEndLookup ends document lookup functions gracefully.
 var ErrEndLookup = errors.New("lookup ended")
 
+// ErrNotFound is returned when a document is not found or has been deleted.
+var ErrNotFound = errors.New("document not found")
+
 const timeKeyFormat = "2006-01-02 15:04:05.9999"
 
 func boltKey(t time.Time) []byte {
@@ -39,23 +42,145 @@ func OpenBoltQAP(dbname string, templates *template.Template) (*boltqap, error)
 		db:   bolt,
 		tmpl: templates,
 	}
+	migrated, err := q.migrateDocuments()
+	if err != nil {
+		return nil, fmt.Errorf("migrating documents: %s", err)
+	}
+	if migrated > 0 {
+		log.Printf("migrated %d documents to current encoding", migrated)
+	}
+	q.filter, err = q.loadSnapshot()
+	if err != nil {
+		log.Println("discarding header filter snapshot:", err)
+	}
+	if q.filter == nil {
+		err = q.rebuildFilter()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = q.DoProjects(func(structure qap.Project) error {
+		return q.filter.SetNumberingPolicy(structure.Project(), structure.Numbering)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading project numbering policies: %s", err)
+	}
+	return q, nil
+}
+
+// rebuildFilter initializes the filter from all documents in the
+// database and stores a snapshot of it for faster startup. Numbers of
+// deleted main documents are retired so that they are not allocated again.
+func (q *boltqap) rebuildFilter() error {
 	headers := make([]qap.Header, 0, 1024)
-	err = q.DoDocuments(func(doc document) error {
+	var deleted []qap.Header
+	err := q.DoDocuments(func(doc document) error {
 		hd, err := doc.Header()
 		if err != nil {
 			return err
 		}
+		if doc.Deleted {
+			if hd.AttachmentNumber == 0 {
+				deleted = append(deleted, hd)
+			}
+			return nil
+		}
 		headers = append(headers, hd)
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("initializing headers from file data: %s", err)
+		return fmt.Errorf("initializing headers from file data: %s", err)
 	}
-	q.filter = qap.NewHeaderFilter(headers)
-	return q, nil
+	q.filter = qap.NewSyncHeaderFilter(headers)
+	for _, hd := range deleted {
+		if err := q.filter.Retire(hd); err != nil {
+			return fmt.Errorf("retiring number of deleted document %s: %s", hd, err)
+		}
+	}
+	err = q.saveSnapshot()
+	if err != nil {
+		log.Println("saving header filter snapshot:", err)
+	}
+	return nil
+}
+
+// Close stores a snapshot of the filter and closes the database.
+func (q *boltqap) Close() error {
+	if q.filter != nil {
+		if err := q.saveSnapshot(); err != nil {
+			log.Println("saving header filter snapshot:", err)
+		}
+	}
+	return q.db.Close()
 }
 
-func (q *boltqap) Close() error { return q.db.Close() }
+// schemaVersion is the version of the document encoding. Databases with an older
+// schema version are migrated on startup.
+const schemaVersion = 1
+
+// migrateDocuments rewrites documents stored in a legacy encoding, such as
+// revisions and attachments stored as raw byte arrays, using the current encoding.
+// Databases already at the current schema version are not modified.
+func (q *boltqap) migrateDocuments() (migrated int, err error) {
+	current := false
+	err = q.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(metaBucket)
+		current = b != nil && getUint64(b, keySchemaVersion) >= schemaVersion
+		return nil
+	})
+	if err != nil || current {
+		return 0, err
+	}
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		err := tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if len(name) != 3 {
+				return nil
+			}
+			var keys, values [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				doc, err := docFromValue(v)
+				if err != nil {
+					log.Println("error reading document from database: ", err.Error())
+					return nil
+				}
+				val, err := doc.value()
+				if err != nil {
+					return fmt.Errorf("encoding document %s: %s", doc, err)
+				}
+				if !bytes.Equal(v, val) {
+					keys = append(keys, append([]byte{}, k...))
+					values = append(values, val)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for i := range keys {
+				if err := b.Put(keys[i], values[i]); err != nil {
+					return err
+				}
+			}
+			migrated += len(keys)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if migrated > 0 {
+			err = bumpGeneration(tx)
+			if err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		return putUint64(meta, keySchemaVersion, schemaVersion)
+	})
+	return migrated, err
+}
 
 func abs(a int) int {
 	if a < 0 {
@@ -66,7 +191,7 @@ func abs(a int) int {
 
 type boltqap struct {
 	db       *bbolt.DB
-	filter   qap.HeaderFilter
+	filter   *qap.SyncHeaderFilter
 	tmpl     *template.Template
 	projects map[string]qap.Project
 }
@@ -100,10 +225,10 @@ func (q *boltqap) CreateProject(code, name, desc string) error {
 		return errors.New("error creating project, probably already exists: " + err.Error())
 	}
 	err = q.PutStructure(qap.Project{
-		Code:        [3]byte{0: code[0], 1: code[1], 2: code[2]},
+		Code:        [4]byte{0: code[0], 1: code[1], 2: code[2]},
 		Name:        name,
 		Description: desc,
-	})
+	}, changeNote{Comment: "project created"})
 	if err != nil {
 		log.Println("while putting initial project structure:", err)
 	}
@@ -111,16 +236,16 @@ func (q *boltqap) CreateProject(code, name, desc string) error {
 }
 
 func (q *boltqap) NewDocument(doc document) error {
+	if err := q.setFirstRevision(&doc); err != nil {
+		return err
+	}
 	info, err := doc.ValidateForAdmission()
-	err = q.filter.Do(func(_ int, h qap.Header) error {
-		if qap.HeadersEqual(h, info.Header) {
-			return errors.New("document already exists:" + h.String())
-		}
-		return nil
-	})
 	if err != nil {
 		return err
 	}
+	if q.filter.Has(info.Header) {
+		return errors.New("document already exists:" + info.Header.String())
+	}
 	return q.addDoc(doc)
 }
 
@@ -128,29 +253,57 @@ func (q *boltqap) NewMainDocument(doc document) (newdoc document, err error) {
 	if doc.Revised.Before(doc.Created) {
 		doc.Revised = time.Now() // ensure consistency
 	}
-	info, err := doc.ValidateForAdmission()
+	if err := q.setFirstRevision(&doc); err != nil {
+		return document{}, err
+	}
 	doc.Number = 1 // Actual number assigned below.
-	var maxCode int32
-	q.filter.Do(func(i int, h qap.Header) error {
-		if qap.HeaderCodesEqual(h, info.Header) {
-			if h.Number > maxCode {
-				maxCode = h.Number
-			}
-		}
-		return nil
-	})
+	info, err := doc.ValidateForAdmission()
+	if err != nil {
+		return document{}, err
+	}
 	structure, err := q.GetStructure(doc.Project)
+	if err != nil {
+		return document{}, err
+	}
 	if !structure.ContainsCode(info.Header) {
 		return document{}, errors.New("equipment code is not defined in project structure. Must be added first.")
 	}
-	doc.Number = int(maxCode) + 1
-	err = q.addDoc(doc)
+	if err := structure.ValidateDocumentType(doc.Equipment, doc.DocType); err != nil {
+		return document{}, err
+	}
+	// Number is allocated and reserved in the filter in one step so that
+	// concurrent requests are never given the same number.
+	hd, err := q.filter.AddNextNumber(doc.Project, doc.Equipment, doc.DocType)
+	if err != nil {
+		return document{}, err
+	}
+	doc.Number = int(hd.Number)
+	err = q.putDoc(doc)
 	if err != nil {
+		q.filter.Remove(hd)
 		return document{}, err
 	}
 	return doc, nil
 }
 
+// setFirstRevision gives a document without revisions the first
+// revision of its project's revision index scheme.
+func (q *boltqap) setFirstRevision(doc *document) error {
+	if len(doc.Revisions) != 0 {
+		return nil
+	}
+	structure, err := q.GetStructure(doc.Project)
+	if err != nil {
+		return err
+	}
+	scheme := structure.RevisionScheme()
+	if scheme == nil {
+		return errors.New("project has invalid revision scheme")
+	}
+	doc.Revisions = []revision{{Index: scheme.First(), Description: "first revision"}}
+	return nil
+}
+
 // addDoc adds the document with minimal validation. If document already
 // exists it returns error.
 func (q *boltqap) addDoc(doc document) error {
@@ -162,8 +315,17 @@ func (q *boltqap) addDoc(doc document) error {
 	if err != nil {
 		return errors.New("unexpected error attempting to add document: " + err.Error())
 	}
+	err = q.putDoc(doc)
+	if err != nil {
+		q.filter.Remove(hd)
+	}
+	return err
+}
+
+// putDoc stores a new document in the database without adding it to the filter.
+func (q *boltqap) putDoc(doc document) error {
 	return q.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(hd.Project()))
+		b := tx.Bucket([]byte(doc.Project))
 		if b == nil {
 			return errors.New("project not exist")
 		}
@@ -172,11 +334,15 @@ func (q *boltqap) addDoc(doc document) error {
 		if v != nil {
 			return errors.New("key already exists in document")
 		}
-		err = b.Put(key, doc.value())
+		val, err := doc.value()
+		if err != nil {
+			return err
+		}
+		err = b.Put(key, val)
 		if err != nil {
 			return fmt.Errorf("while putting document %v in database: %s", doc, err)
 		}
-		return nil
+		return bumpGeneration(tx)
 	})
 }
 
@@ -320,51 +486,294 @@ func (q *boltqap) ImportDocuments(documents []document) (err error) {
 	if err := tx.Commit(); err != nil {
 		return err
 	}
-	for _, doc := range documents {
+	headers := make([]qap.Header, len(documents))
+	for i, doc := range documents {
 		// Documents are guaranteed to be valid by this point.
-		hd, _ := doc.Header()
-		q.filter.AddHeader(hd)
+		headers[i], _ = doc.Header()
 	}
-	return nil
+	return q.filter.AddHeaders(headers)
 }
 
 // FindDocument finds the document identically matching the header.
+// Deleted documents are not found.
 func (q *boltqap) FindDocument(target qap.Header) (doc document, err error) {
+	err = q.db.View(func(tx *bbolt.Tx) error {
+		doc, err = findDocument(tx, target)
+		return err
+	})
+	return doc, err
+}
+
+// findDocument finds the document identically matching the header in the transaction.
+func findDocument(tx *bbolt.Tx, target qap.Header) (doc document, err error) {
 	err = target.Validate()
 	if err != nil {
 		return document{}, err
 	}
-	err = q.DoProjectDocuments(target.Project(), func(d document) error {
+	b := tx.Bucket([]byte(target.Project()))
+	if b == nil {
+		return document{}, fmt.Errorf("project %q not found", target.Project())
+	}
+	err = b.ForEach(func(k, v []byte) error {
+		d, err := docFromValue(v)
+		if err != nil {
+			log.Println("error reading document from database: ", err.Error())
+			return nil
+		}
 		h, err := d.Header()
 		if err != nil {
 			return fmt.Errorf("document %s has Header error: %s", d, err)
 		}
-		if qap.HeadersEqual(h, target) {
+		if !d.Deleted && qap.HeadersEqual(h, target) {
 			doc = d
 			return ErrEndLookup
 		}
 		return nil
 	})
-	return doc, err
+	if errors.Is(err, ErrEndLookup) {
+		return doc, nil
+	} else if err != nil {
+		return document{}, err
+	}
+	return document{}, fmt.Errorf("%w: %s", ErrNotFound, target)
 }
 
-func (q *boltqap) AddRevision(target qap.Header, newrev revision) error {
-	err := newrev.Index.Validate()
+// updateDocument finds the target document, changes it with change and stores
+// it in a single transaction so that concurrent updates are not lost.
+func (q *boltqap) updateDocument(target qap.Header, change func(doc *document) error) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		doc, err := findDocument(tx, target)
+		if err != nil {
+			return err
+		}
+		err = change(&doc)
+		if err != nil {
+			return err
+		}
+		if _, err := doc.Info(); err != nil {
+			return err
+		}
+		val, err := doc.value()
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte(doc.Project)).Put(doc.key(), val)
+		if err != nil {
+			return err
+		}
+		return bumpGeneration(tx)
+	})
+}
+
+// DeleteDocument marks the target document as deleted and removes it from the
+// filter. Deleted documents remain in the DB. Main documents must have their
+// attachments deleted first.
+func (q *boltqap) DeleteDocument(target qap.Header) error {
+	doc, err := q.FindDocument(target)
 	if err != nil {
 		return err
 	}
-	doc, err := q.FindDocument(target)
+	for _, attachment := range doc.Attachments {
+		if q.filter.Has(attachment) {
+			return errors.New("document has attachment " + attachment.String() + " which must be deleted first")
+		}
+	}
+	doc.Deleted = true
+	err = q.Update(doc)
 	if err != nil {
 		return err
 	}
-	incoming := newrev.Index
-	latest := doc.Revision()
-	min, maj := qap.AreSequential(latest, incoming)
-	if !min && !maj {
-		return errors.New("revision is not sequential")
+	err = q.filter.Remove(target)
+	if err != nil {
+		return err
 	}
-	doc.Revisions = append(doc.Revisions, newrev)
-	return q.Update(doc)
+	q.compactFilter()
+	return nil
+}
+
+// compactFilter compacts the header filter once removed headers take
+// up more than a quarter of the space of the headers it contains.
+func (q *boltqap) compactFilter() {
+	if q.filter.Tombstones() > q.filter.Len()/4 {
+		q.filter.Compact()
+	}
+}
+
+// EditDocument edits the human name, file extension, location, equipment
+// and document type of the target document. Empty fields of edit are left
+// unchanged. Attachments of a main document are renamed along with it.
+func (q *boltqap) EditDocument(target qap.Header, edit document) (document, error) {
+	doc, err := q.FindDocument(target)
+	if err != nil {
+		return document{}, err
+	}
+	if edit.Project != "" && edit.Project != doc.Project {
+		return document{}, errors.New("document project can not be changed")
+	}
+	if edit.HumanName != "" {
+		doc.HumanName = edit.HumanName
+	}
+	if edit.FileExtension != "" {
+		doc.FileExtension = edit.FileExtension
+	}
+	if edit.Location != "" {
+		doc.Location = edit.Location
+	}
+	docs := []document{doc}
+	rename := (edit.Equipment != "" && edit.Equipment != doc.Equipment) ||
+		(edit.DocType != "" && edit.DocType != doc.DocType)
+	if rename {
+		if doc.Attachment != 0 {
+			return document{}, errors.New("attachment codes can only be changed through their main document")
+		}
+		if edit.DocType != "" && edit.DocType != doc.DocType {
+			equipment := doc.Equipment
+			if edit.Equipment != "" {
+				equipment = edit.Equipment
+			}
+			structure, err := q.GetStructure(doc.Project)
+			if err != nil {
+				return document{}, err
+			}
+			if err := structure.ValidateDocumentType(equipment, edit.DocType); err != nil {
+				return document{}, err
+			}
+		}
+		for _, hd := range doc.Attachments {
+			if !q.filter.Has(hd) {
+				continue // Deleted attachment.
+			}
+			attachment, err := q.FindDocument(hd)
+			if err != nil {
+				return document{}, err
+			}
+			docs = append(docs, attachment)
+		}
+	}
+	olds := make([]qap.Header, len(docs))
+	for i := range docs {
+		olds[i], _ = docs[i].Header() // Found documents have valid headers.
+	}
+	if rename {
+		for i := range docs {
+			if edit.Equipment != "" {
+				docs[i].Equipment = edit.Equipment
+			}
+			if edit.DocType != "" {
+				docs[i].DocType = edit.DocType
+			}
+		}
+		newHd, err := docs[0].Header()
+		if err != nil {
+			return document{}, err
+		}
+		structure, err := q.GetStructure(doc.Project)
+		if err != nil {
+			return document{}, err
+		}
+		if !structure.ContainsCode(newHd) {
+			return document{}, errors.New("equipment code is not defined in project structure. Must be added first.")
+		}
+		// Only attachments renamed along with the main document are recoded.
+		// Deleted attachments keep the name they were deleted with.
+		for i, hd := range docs[0].Attachments {
+			for j := 1; j < len(docs); j++ {
+				if olds[j] == hd {
+					docs[0].Attachments[i], err = docs[j].Header()
+					if err != nil {
+						return document{}, err
+					}
+				}
+			}
+		}
+	}
+	news := make([]qap.Header, len(docs))
+	for i := range docs {
+		news[i], err = docs[i].Header()
+		if err != nil {
+			return document{}, err
+		}
+		if rename && q.filter.Has(news[i]) {
+			return document{}, errors.New("document " + news[i].String() + " already exists")
+		}
+	}
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		buck := tx.Bucket([]byte(doc.Project))
+		if buck == nil {
+			return errors.New(doc.Project + " project does not exist")
+		}
+		for _, d := range docs {
+			val, err := d.value()
+			if err != nil {
+				return err
+			}
+			if err := buck.Put(d.key(), val); err != nil {
+				return err
+			}
+		}
+		return bumpGeneration(tx)
+	})
+	if err != nil {
+		return document{}, err
+	}
+	for i := range docs {
+		if err := q.filter.Replace(olds[i], news[i]); err != nil {
+			return document{}, err
+		}
+	}
+	q.compactFilter()
+	return docs[0], nil
+}
+
+func (q *boltqap) AddRevision(target qap.Header, newrev revision) error {
+	err := newrev.Index.Validate()
+	if err != nil {
+		return err
+	}
+	return q.updateDocument(target, func(doc *document) error {
+		if doc.State() == qap.StateUnderApproval {
+			return errors.New("latest revision is under approval")
+		}
+		if len(doc.Revisions) == 0 {
+			doc.Revisions = []revision{{Index: doc.Revision()}}
+		}
+		doc.Revisions = append(doc.Revisions, newrev)
+		err := qap.ValidateHistory(doc.RevisionHistory())
+		if err != nil {
+			return fmt.Errorf("revision is not sequential: %w", err)
+		}
+		return nil
+	})
+}
+
+// Transition changes the lifecycle state of the latest revision of the target
+// document. Released and obsolete revisions are marked as releases. Revisions
+// are submitted for approval and released through SubmitForApproval and Review.
+func (q *boltqap) Transition(target qap.Header, to qap.State) error {
+	if to == qap.StateUnderApproval || to == qap.StateReleased {
+		return fmt.Errorf("transition to %s requires the approval workflow", to)
+	}
+	return q.updateDocument(target, func(doc *document) error {
+		return doc.transition(to)
+	})
+}
+
+// SubmitForApproval submits the latest revision of the target document
+// for approval by reviewers. All reviewers must approve the revision for
+// it to be released.
+func (q *boltqap) SubmitForApproval(target qap.Header, reviewers []string) error {
+	return q.updateDocument(target, func(doc *document) error {
+		return doc.submit(reviewers, time.Now())
+	})
+}
+
+// Review records the decision of reviewer on the latest revision of the target
+// document. The revision is released once all reviewers have approved it and
+// returns to In Work if it is rejected.
+func (q *boltqap) Review(target qap.Header, reviewer string, approve bool, comment string) error {
+	return q.updateDocument(target, func(doc *document) error {
+		return doc.review(reviewer, approve, comment, time.Now())
+	})
 }
 
 func (q *boltqap) Update(d document) error {
@@ -382,7 +791,15 @@ func (q *boltqap) Update(d document) error {
 		if exist == nil {
 			return errors.New(d.String() + " document does not exist in DB")
 		}
-		return buck.Put(key, d.value())
+		val, err := d.value()
+		if err != nil {
+			return err
+		}
+		err = buck.Put(key, val)
+		if err != nil {
+			return err
+		}
+		return bumpGeneration(tx)
 	})
 }
 
@@ -397,60 +814,146 @@ func (q *boltqap) importDocuments(tx *bbolt.Tx, documents []document) error {
 		if existing != nil {
 			return fmt.Errorf("imported document %q cannot have same creation time as existing document", doc.String())
 		}
-		err := bucket.Put(key, doc.value())
+		val, err := doc.value()
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(key, val)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return bumpGeneration(tx)
+}
+
+// equipmentPaths returns a function that returns the human readable path of
+// an equipment code in the structure of a project. Structures are read once.
+func (q *boltqap) equipmentPaths() func(project, equipment string) string {
+	structures := make(map[string]qap.Project)
+	q.DoProjects(func(structure qap.Project) error {
+		structures[structure.Project()] = structure
+		return nil
+	})
+	return func(project, equipment string) string {
+		nodes, _ := structures[project].Resolve(equipment)
+		return qap.NodePath(nodes)
+	}
 }
 
 func (q *boltqap) GetStructure(project string) (structure qap.Project, err error) {
+	err = q.db.View(func(tx *bbolt.Tx) error {
+		structure, err = getStructure(tx, project)
+		return err
+	})
+	return structure, err
+}
+
+func getStructure(tx *bbolt.Tx, project string) (structure qap.Project, err error) {
 	if len(project) != 3 {
 		return structure, qap.ErrBadProjectCode
 	}
-	name := "meta" + project
-	return structure, q.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(name))
-		if b == nil {
-			return errors.New("project metadata not found")
+	b := tx.Bucket([]byte("meta" + project))
+	if b == nil {
+		return structure, errors.New("project metadata not found")
+	}
+	v := b.Get([]byte("structure"))
+	return structure, json.Unmarshal(v, &structure)
+}
+
+// EditStructure applies edit to the structure of project and stores the result.
+// Changes which leave documents outside of the structure are refused unless force is set.
+// The structure is loaded, edited and stored in a single transaction so that
+// concurrent edits are not lost.
+func (q *boltqap) EditStructure(project string, note changeNote, force bool, edit func(p *qap.Project) (qap.Impact, error)) (impact qap.Impact, err error) {
+	var structure qap.Project
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		structure, err = getStructure(tx, project)
+		if err != nil {
+			return err
+		}
+		impact, err = edit(&structure)
+		if err != nil {
+			return err
+		}
+		if impact.Orphans() && !force {
+			return fmt.Errorf("change refused, %s", impact)
+		}
+		return putStructure(tx, structure, note)
+	})
+	if err != nil {
+		return impact, err
+	}
+	return impact, q.filter.SetNumberingPolicy(project, structure.Numbering)
+}
+
+// ImportStructure adds the breakdown rows to the project structure. If apply is
+// false or there are issues the structure with the rows imported is returned
+// without being stored so that the import can be previewed.
+func (q *boltqap) ImportStructure(project string, note changeNote, rows []qap.BreakdownRow, apply bool) (structure qap.Project, issues []qap.BreakdownIssue, err error) {
+	if !apply {
+		structure, err = q.GetStructure(project)
+		if err != nil {
+			return qap.Project{}, nil, err
+		}
+		return structure, structure.ImportBreakdown(rows), nil
+	}
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		structure, err = getStructure(tx, project)
+		if err != nil {
+			return err
+		}
+		issues = structure.ImportBreakdown(rows)
+		if len(issues) > 0 {
+			return nil
 		}
-		v := b.Get([]byte("structure"))
-		return json.Unmarshal(v, &structure)
+		return putStructure(tx, structure, note)
 	})
+	if err != nil || len(issues) > 0 {
+		return structure, issues, err
+	}
+	return structure, nil, q.filter.SetNumberingPolicy(project, structure.Numbering)
+}
+
+// PutStructure stores structure as the current structure of its project and
+// appends it to the project's structure history along with note.
+func (q *boltqap) PutStructure(structure qap.Project, note changeNote) error {
+	err := q.db.Update(func(tx *bbolt.Tx) error {
+		return putStructure(tx, structure, note)
+	})
+	if err != nil {
+		return err
+	}
+	return q.filter.SetNumberingPolicy(structure.Project(), structure.Numbering)
 }
 
-func (q *boltqap) PutStructure(structure qap.Project) (err error) {
+func putStructure(tx *bbolt.Tx, structure qap.Project, note changeNote) error {
 	str := structure.Project()
 	if len(str) != 3 {
 		return errors.New("bad project code")
 	}
-	metakey := []byte("meta" + str)
-	tx, err := q.db.Begin(true)
-	if err != nil {
-		return err
+	if err := structure.Numbering.Validate(); err != nil {
+		return fmt.Errorf("project numbering policy: %s", err)
 	}
-	defer tx.Commit()
+	metakey := []byte("meta" + str)
 	b := tx.Bucket(metakey)
 	if b == nil {
-		if tx.Bucket([]byte(str)) != nil {
-			_, err = tx.CreateBucket(metakey)
-			log.Println("project exists, attempted to create missing metadata bucket. err:", err)
-		} else {
-			tx.Rollback()
+		if tx.Bucket([]byte(str)) == nil {
+			return errors.New("project " + str + " metadata not found")
 		}
-		return errors.New("project " + str + " metadata not found, try again?")
+		var err error
+		b, err = tx.CreateBucket(metakey)
+		if err != nil {
+			return err
+		}
+		log.Println("project " + str + " exists, created missing metadata bucket")
 	}
 	val, err := json.Marshal(structure)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	key := []byte("structure")
-	err = b.Put(key, val)
+	err = putStructureVersion(b, structure, note, time.Now())
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	return nil
+	return b.Put([]byte("structure"), val)
 }
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/soypat/go-qap"
+	"go.etcd.io/bbolt"
 )
 
 func TestBoltKey(t *testing.T) {
@@ -173,3 +178,836 @@ func TestDoDocumentRange(t *testing.T) {
 		}
 	})
 }
+
+func TestMigrateLegacyDocuments(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	err = q.CreateProject("LHC", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Document as stored prior to text marshaling of qap types.
+	const legacy = `{"Project":"LHC","Equipment":"PM","DocType":"QA","SubmittedBy":"pato","Number":202,"Attachment":0,` +
+		`"HumanName":"plan","FileExtension":".pdf","Location":"/qa/","Created":"2000-01-01T00:00:00Z","Revised":"2000-01-01T00:00:00Z","Deleted":false,` +
+		`"Revisions":[{"Index":{"Index":[65,49],"IsRelease":false},"Description":"first"},{"Index":{"Index":[66,50],"IsRelease":true},"Description":"second"}],` +
+		`"Attachments":[{"Number":202,"ProjectCode":[76,72,67],"EquipmentCode":[80,77,0,0,0],"DocumentTypeCode":[81,65],"AttachmentNumber":1}]}`
+	key := boltKey(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		// Databases created prior to schema versioning have no schema version.
+		if err := tx.Bucket(metaBucket).Delete(keySchemaVersion); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("LHC")).Put(key, []byte(legacy))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	var stored []byte
+	q.db.View(func(tx *bbolt.Tx) error {
+		stored = append(stored, tx.Bucket([]byte("LHC")).Get(key)...)
+		return nil
+	})
+	const expectRevisions = `"Revisions":[{"Index":"A.1-draft","Description":"first"},{"Index":"B.2","Description":"second"}],"Attachments":["LHC-PM-QA-202.01"]`
+	if !strings.Contains(string(stored), expectRevisions) {
+		t.Errorf("expected migrated document to contain %s, got %s", expectRevisions, stored)
+	}
+	hd, _ := qap.ParseHeader("LHC-PM-QA-202.00", false)
+	if !q.filter.Has(hd) {
+		t.Error("migrated document not found in filter")
+	}
+}
+
+func TestMigrateOnce(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	err = q.CreateProject("LHC", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+	// A document in a non-canonical encoding must be left as is when
+	// the database is already at the current schema version.
+	const stale = `{"Project":"LHC","Equipment":"PM","DocType":"QA","SubmittedBy":"pato","Number":202,` +
+		`"HumanName":"plan","FileExtension":".pdf","Location":"/qa/","Created":"2000-01-01T00:00:00Z","Revised":"2000-01-01T00:00:00Z"}`
+	key := boltKey(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generation uint64
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		generation = getUint64(tx.Bucket(metaBucket), keyGeneration)
+		return tx.Bucket([]byte("LHC")).Put(key, []byte(stale))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.db.View(func(tx *bbolt.Tx) error {
+		if got := string(tx.Bucket([]byte("LHC")).Get(key)); got != stale {
+			t.Errorf("document rewritten on warm start: %s", got)
+		}
+		if got := getUint64(tx.Bucket(metaBucket), keyGeneration); got != generation {
+			t.Errorf("generation changed on warm start from %d to %d", generation, got)
+		}
+		return nil
+	})
+}
+
+func TestDocumentTransitions(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time1 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: 1, Created: time1, Revised: time1}
+	err = q.addDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hd, _ := doc.Header()
+	rev, _ := qap.ParseRevision("A.2-draft")
+	err = q.AddRevision(hd, revision{Index: rev, Description: "second", State: qap.StateInWork})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Transition(hd, qap.StateReleased); err == nil {
+		t.Error("expected error releasing revision outside approval workflow")
+	}
+	if err := q.SubmitForApproval(hd, []string{"ana", " bob", "", "Ana"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Review(hd, "carl", true, ""); err == nil {
+		t.Error("expected error reviewing by non reviewer")
+	}
+	if err := q.Review(hd, "bob", false, ""); err == nil {
+		t.Error("expected error rejecting without comment")
+	}
+	if err := q.Review(hd, "bob", false, "missing drawing"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.FindDocument(hd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State() != qap.StateInWork {
+		t.Errorf("expected rejected revision to be in work, got %s", got.State())
+	}
+	if err := q.SubmitForApproval(hd, []string{"ana", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, reviewer := range []string{"ana", "bob"} {
+		if err := q.Review(hd, reviewer, true, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = q.FindDocument(hd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State() != qap.StateReleased || got.Version() != "A.2" {
+		t.Errorf("expected released A.2 revision, got %s %s", got.Version(), got.State())
+	}
+	if len(got.Revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(got.Revisions))
+	}
+	if n := len(got.Revisions[1].Approvals); n != 4 {
+		t.Errorf("expected 4 stored approvals over 2 rounds, got %d", n)
+	}
+	if err := q.Transition(hd, qap.StateObsolete); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentReview(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time1 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: 1, Created: time1, Revised: time1}
+	err = q.addDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hd, _ := doc.Header()
+	rev, _ := qap.ParseRevision("A.2-draft")
+	err = q.AddRevision(hd, revision{Index: rev, Description: "second", State: qap.StateInWork})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewers := []string{"ana", "bob", "carl", "dan", "eve", "fay"}
+	if err := q.SubmitForApproval(hd, reviewers); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for _, reviewer := range reviewers {
+		wg.Add(1)
+		go func(reviewer string) {
+			defer wg.Done()
+			if err := q.Review(hd, reviewer, true, ""); err != nil {
+				t.Error(err)
+			}
+		}(reviewer)
+	}
+	wg.Wait()
+	got, err := q.FindDocument(hd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(got.Revisions[1].Approvals); n != len(reviewers) {
+		t.Errorf("expected %d stored approvals, got %d", len(reviewers), n)
+	}
+	if got.State() != qap.StateReleased {
+		t.Errorf("expected released revision after all approvals, got %s", got.State())
+	}
+}
+
+func TestDeleteAndEditDocument(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"A", "B"} {
+		if err := structure.AddEquipmentCode(code, "sys"+code, "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	time1 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	main := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: 1, HumanName: "main", Created: time1, Revised: time1}
+	attachment := main
+	attachment.Attachment = 1
+	attachment.Created = time1.Add(time.Second)
+	attachmentHd, _ := attachment.Header()
+	deleted := main
+	deleted.Attachment = 2
+	deleted.Created = time1.Add(2 * time.Second)
+	deletedHd, _ := deleted.Header()
+	main.Attachments = []qap.Header{attachmentHd, deletedHd}
+	for _, doc := range []document{main, attachment, deleted} {
+		if err := q.addDoc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.DeleteDocument(deletedHd); err != nil {
+		t.Fatal(err)
+	}
+	mainHd, _ := main.Header()
+	edited, err := q.EditDocument(mainHd, document{Project: "SPS", Equipment: "B", DocType: "QA", HumanName: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.String() != "SPS-B-QA-001" || edited.HumanName != "renamed" {
+		t.Errorf("unexpected edited document %s %q", edited, edited.HumanName)
+	}
+	if len(edited.Attachments) != 2 || edited.Attachments[1] != deletedHd {
+		t.Errorf("expected deleted attachment to keep its name %s, got %v", deletedHd, edited.Attachments)
+	}
+	newMainHd, _ := edited.Header()
+	newAttachmentHd := edited.Attachments[0]
+	if q.filter.Has(mainHd) || q.filter.Has(attachmentHd) || !q.filter.Has(newMainHd) || !q.filter.Has(newAttachmentHd) {
+		t.Error("filter not consistent with renamed documents")
+	}
+	if q.filter.Tombstones() != 0 {
+		t.Errorf("expected filter compacted after renaming, got %d tombstones", q.filter.Tombstones())
+	}
+	if _, err := q.FindDocument(newAttachmentHd); err != nil {
+		t.Errorf("renamed attachment not found: %s", err)
+	}
+	if _, err := q.FindDocument(mainHd); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected old name not found, got %v", err)
+	}
+	if err := q.DeleteDocument(newMainHd); err == nil {
+		t.Error("expected error deleting document with attachments")
+	}
+	for _, hd := range []qap.Header{newAttachmentHd, newMainHd} {
+		if err := q.DeleteDocument(hd); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.FindDocument(hd); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected deleted document %s not found, got %v", hd, err)
+		}
+		if q.filter.Has(hd) {
+			t.Errorf("deleted document %s in filter", hd)
+		}
+	}
+	if q.filter.Tombstones() != 0 {
+		t.Errorf("expected filter compacted after deleting, got %d tombstones", q.filter.Tombstones())
+	}
+	q.Close()
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.filter.Len() != 0 {
+		t.Errorf("expected deleted documents absent from filter after reopening, got %d headers", q.filter.Len())
+	}
+}
+
+func TestConcurrentAddSearch(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const writers, perWriter = 4, 25
+	time1 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				n := w*perWriter + i
+				doc := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: n + 1,
+					Created: time1.Add(time.Duration(n) * time.Second), Revised: time1}
+				if err := q.addDoc(doc); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dst := make([]qap.Header, 40)
+			for i := 0; i < perWriter; i++ {
+				q.filter.HumanQuery(dst, "SPS-A-HP", 0)
+			}
+		}()
+	}
+	wg.Wait()
+	dst := make([]qap.Header, writers*perWriter)
+	n, total := q.filter.HumanQuery(dst, "SPS-A-HP", 0)
+	if n != writers*perWriter || total != n {
+		t.Errorf("expected %d documents, got n=%d total=%d", writers*perWriter, n, total)
+	}
+}
+
+func TestDeletedNumberNotReissued(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := structure.AddEquipmentCode("A", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	newDoc := func(n int) document {
+		t.Helper()
+		created := now.Add(time.Duration(n) * time.Second)
+		doc, err := q.NewMainDocument(document{Project: "SPS", Equipment: "A", DocType: "QA", SubmittedBy: "ana",
+			HumanName: "doc", FileExtension: ".pdf", Location: "/", Created: created, Revised: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	doc := newDoc(0)
+	hd, _ := doc.Header()
+	if err := q.DeleteDocument(hd); err != nil {
+		t.Fatal(err)
+	}
+	if doc = newDoc(1); doc.Number != 2 {
+		t.Errorf("expected number 2 after deleting number 1, got %d", doc.Number)
+	}
+	hd, _ = doc.Header()
+	if err := q.DeleteDocument(hd); err != nil {
+		t.Fatal(err)
+	}
+	// Numbers must stay retired when loading the filter from its snapshot.
+	q.Close()
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc = newDoc(2); doc.Number != 3 {
+		t.Errorf("expected number 3 after loading snapshot, got %d", doc.Number)
+	}
+	hd, _ = doc.Header()
+	if err := q.DeleteDocument(hd); err != nil {
+		t.Fatal(err)
+	}
+	// And when rebuilding the filter from the database.
+	err = q.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metaBucket).Delete(keySnapshot)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.db.Close()
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if doc = newDoc(3); doc.Number != 4 {
+		t.Errorf("expected number 4 after rebuilding filter, got %d", doc.Number)
+	}
+}
+
+func TestConcurrentNewMainDocument(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := structure.AddEquipmentCode("A", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	structure.Numbering = qap.NumberingPolicy{Reserved: []qap.NumberRange{{Min: 1, Max: 9}}}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	const writers, perWriter = 4, 10
+	now := time.Now()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	numbers := make(map[int]bool)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				n := w*perWriter + i
+				created := now.Add(-time.Duration(n) * time.Second)
+				doc := document{Project: "SPS", Equipment: "A", DocType: "DR", SubmittedBy: "ana", HumanName: "doc",
+					FileExtension: ".pdf", Location: "/", Created: created, Revised: created}
+				newdoc, err := q.NewMainDocument(doc)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if numbers[newdoc.Number] || newdoc.Number < 10 {
+					t.Errorf("number %d allocated twice or reserved", newdoc.Number)
+				}
+				numbers[newdoc.Number] = true
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if len(numbers) != writers*perWriter {
+		t.Errorf("expected %d distinct numbers, got %d", writers*perWriter, len(numbers))
+	}
+}
+
+func TestFilterSnapshot(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time1 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc1 := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: 1, Created: time1, Revised: time1}
+	if err := q.addDoc(doc1); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	// Document written behind the server's back without incrementing
+	// the generation is not seen since the snapshot is loaded.
+	doc2 := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: 2, Created: time1.Add(time.Second), Revised: time1}
+	putRaw := func(doc document, bump bool) {
+		db, err := bbolt.Open(testFile, 0666, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		err = db.Update(func(tx *bbolt.Tx) error {
+			val, err := doc.value()
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket([]byte(doc.Project)).Put(doc.key(), val); err != nil {
+				return err
+			}
+			if bump {
+				return bumpGeneration(tx)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hd1, _ := doc1.Header()
+	hd2, _ := doc2.Header()
+	putRaw(doc2, false)
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.filter.Has(hd1) || q.filter.Has(hd2) {
+		t.Error("expected filter loaded from snapshot")
+	}
+	q.Close()
+
+	// Incrementing the generation makes the snapshot stale.
+	doc3 := document{Project: "SPS", Equipment: "A", DocType: "HP", Number: 3, Created: time1.Add(2 * time.Second), Revised: time1}
+	hd3, _ := doc3.Header()
+	putRaw(doc3, true)
+	q, err = OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if !q.filter.Has(hd1) || !q.filter.Has(hd2) || !q.filter.Has(hd3) {
+		t.Error("expected filter rebuilt from stale snapshot")
+	}
+}
+
+func TestEditStructure(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"A", "AB", "C"} {
+		if err := structure.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	time1 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := document{Project: "SPS", Equipment: "AB", DocType: "HP", Number: 1, Created: time1, Revised: time1}
+	if err := q.addDoc(doc); err != nil {
+		t.Fatal(err)
+	}
+	hd, _ := doc.Header()
+	move := func(p *qap.Project) (qap.Impact, error) { return p.MoveNode(q.filter, "AB", "C") }
+	impact, err := q.EditStructure("SPS", changeNote{Author: "test"}, false, move)
+	if err == nil || len(impact.Uncovered) != 1 || impact.Uncovered[0] != hd {
+		t.Errorf("expected move orphaning %s to be refused, got %v %s", hd, err, impact)
+	}
+	structure, _ = q.GetStructure("SPS")
+	if !structure.ContainsCode(hd) {
+		t.Error("refused change was stored")
+	}
+	_, err = q.EditStructure("SPS", changeNote{Author: "test"}, false, func(p *qap.Project) (qap.Impact, error) { return p.DeleteNode(q.filter, "C") })
+	if err != nil {
+		t.Errorf("deleting unused node: %s", err)
+	}
+	if _, err = q.EditStructure("SPS", changeNote{Author: "test"}, true, move); err == nil {
+		t.Error("expected error moving under deleted node")
+	}
+	_, err = q.EditStructure("SPS", changeNote{Author: "test"}, true, func(p *qap.Project) (qap.Impact, error) { return p.DeleteNode(q.filter, "A") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, _ = q.GetStructure("SPS")
+	if structure.ContainsCode(hd) || len(structure.Systems) != 0 {
+		t.Errorf("expected forced deletion to be stored, got %+v", structure.Systems)
+	}
+	// Concurrent edits must not overwrite each other.
+	codes := []string{"D", "E", "F", "G", "H", "J"}
+	var wg sync.WaitGroup
+	for _, code := range codes {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			_, err := q.EditStructure("SPS", changeNote{Author: "test"}, false, func(p *qap.Project) (qap.Impact, error) {
+				return qap.Impact{}, p.AddEquipmentCode(code, "name", "desc")
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(code)
+	}
+	wg.Wait()
+	structure, _ = q.GetStructure("SPS")
+	if len(structure.Systems) != len(codes) {
+		t.Errorf("expected %d systems after concurrent edits, got %+v", len(codes), structure.Systems)
+	}
+}
+
+func TestNewMainDocumentType(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := structure.AddEquipmentCode("A", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := structure.AddEquipmentCode("B", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	newDoc := func(equipment, doctype string, ok bool) {
+		t.Helper()
+		// Creation time is part of the document key.
+		now = now.Add(-time.Second)
+		doc := document{Project: "SPS", Equipment: equipment, DocType: doctype, SubmittedBy: "ana", HumanName: "doc",
+			FileExtension: ".pdf", Location: "/", Created: now, Revised: now}
+		_, err := q.NewMainDocument(doc)
+		if (err == nil) != ok {
+			t.Errorf("SPS-%s-%s: want ok=%t, got error %v", equipment, doctype, ok, err)
+		}
+	}
+	// Projects without document type configuration accept any code.
+	newDoc("A", "HP", true)
+	newDoc("B", "XX", true)
+	if err := structure.RestrictDocumentTypes("A", "QA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		equipment, doctype string
+		ok                 bool
+	}{
+		{"A", "QA", true},
+		{"A", "DR", false},
+		{"B", "DR", true},
+		{"B", "XX", false},
+	} {
+		newDoc(test.equipment, test.doctype, test.ok)
+	}
+}
+
+func TestImportStructure(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := qap.ReadBreakdownCSV(strings.NewReader("A,Alpha\nAB,Beta\nCD,Orphan\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, issues, err := q.ImportStructure("SPS", changeNote{Author: "test"}, rows, true)
+	if err != nil || len(issues) != 1 || issues[0].Line != 3 {
+		t.Fatalf("expected orphan issue at line 3, got %v %v", issues, err)
+	}
+	preview, issues, err := q.ImportStructure("SPS", changeNote{Author: "test"}, rows[:2], false)
+	if err != nil || len(issues) != 0 || len(preview.Breakdown()) != 2 {
+		t.Fatalf("preview: %v %v", issues, err)
+	}
+	structure, _ := q.GetStructure("SPS")
+	if len(structure.Systems) != 0 {
+		t.Fatal("preview or import with issues stored structure")
+	}
+	_, issues, err = q.ImportStructure("SPS", changeNote{Author: "test"}, rows[:2], true)
+	if err != nil || len(issues) != 0 {
+		t.Fatal(issues, err)
+	}
+	structure, _ = q.GetStructure("SPS")
+	if nodes, err := structure.Resolve("AB"); err != nil || qap.NodePath(nodes) != "Alpha > Beta" {
+		t.Errorf("expected imported structure, got %v %v", nodes, err)
+	}
+}
+
+func TestStructureHistory(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"A", "AB"} {
+		if err := structure.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.PutStructure(structure, changeNote{Author: "ana", Comment: "add " + code}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = q.EditStructure("SPS", changeNote{Author: "bo", Comment: "rename"}, false, func(p *qap.Project) (qap.Impact, error) {
+		return qap.Impact{}, p.RenameNode("AB", "beta", "")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := q.StructureHistory("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 4 || versions[0].Version != 4 || versions[0].Author != "bo" || versions[3].Comment != "project created" {
+		t.Fatalf("unexpected history %+v", versions)
+	}
+	for _, test := range []struct {
+		from, to uint64
+		want     string
+	}{
+		{1, 4, "[added system A \"name\" added family AB \"beta\"]"},
+		{2, 3, "[added family AB \"name\"]"},
+		{3, 4, "[renamed family AB \"name\" to \"beta\"]"},
+		{4, 2, "[removed family AB \"beta\"]"},
+	} {
+		from, err := q.GetStructureVersion("SPS", test.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := q.GetStructureVersion("SPS", test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(qap.DiffProjects(from.Structure, to.Structure)); got != test.want {
+			t.Errorf("diff %d..%d: got %s, want %s", test.from, test.to, got, test.want)
+		}
+	}
+	if _, err := q.GetStructureVersion("SPS", 5); err == nil {
+		t.Error("expected error for missing version")
+	}
+}
+
+func TestNewMainDocumentSerial(t *testing.T) {
+	const testFile = "qap_test.db"
+	q, err := OpenBoltQAP(testFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	defer q.Close()
+	err = q.CreateProject("SPS", "name", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure, err := q.GetStructure("SPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"A", "AB", "AB[01-20]"} {
+		if err := structure.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.PutStructure(structure, changeNote{Author: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for equipment, ok := range map[string]bool{"AB01": true, "AB20": true, "AB21": false, "AB1": false} {
+		now = now.Add(-time.Second)
+		doc := document{Project: "SPS", Equipment: equipment, DocType: "DR", SubmittedBy: "ana", HumanName: "doc",
+			FileExtension: ".pdf", Location: "/", Created: now, Revised: now}
+		_, err := q.NewMainDocument(doc)
+		if (err == nil) != ok {
+			t.Errorf("SPS-%s-DR: want ok=%t, got error %v", equipment, ok, err)
+		}
+	}
+}
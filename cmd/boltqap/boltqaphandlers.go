@@ -4,6 +4,8 @@ import (
 	"bytes"
 	_ "embed"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -52,7 +54,10 @@ func (q *boltqap) handleGetDocument(rw http.ResponseWriter, r *http.Request) {
 	}
 	log.Println("get document", hd.String())
 	doc, err := q.FindDocument(hd)
-	if err != nil {
+	if errors.Is(err, ErrNotFound) {
+		httpErr(rw, "document not found", err, http.StatusNotFound)
+		return
+	} else if err != nil {
 		httpErr(rw, "error looking for document", err, http.StatusInternalServerError)
 		return
 	}
@@ -61,7 +66,21 @@ func (q *boltqap) handleGetDocument(rw http.ResponseWriter, r *http.Request) {
 		q.handleDocumentAction(rw, r, doc, query)
 		return
 	}
-	err = q.tmpl.Lookup("document.tmpl").Execute(rw, doc)
+	structure, err := q.GetStructure(doc.Project)
+	if err != nil {
+		log.Println("document project structure:", err)
+	}
+	// Equipment codes missing from the structure are resolved partially.
+	path, _ := structure.Resolve(doc.Equipment)
+	err = q.tmpl.Lookup("document.tmpl").Execute(rw, struct {
+		Doc       document
+		Path      []qap.Node
+		Requester string
+	}{
+		Doc:       doc,
+		Path:      path,
+		Requester: requester(r),
+	})
 	if err != nil {
 		log.Println("error in document template: ", err)
 	}
@@ -72,11 +91,31 @@ func (q *boltqap) handleCreateProject(rw http.ResponseWriter, r *http.Request) {
 	project := query.Get("newcode")
 	name := query.Get("name")
 	desc := query.Get("desc")
+	kind := qap.RevisionQAP202
+	if revisions := query.Get("revisions"); revisions != "" {
+		var err error
+		kind, err = qap.ParseRevisionKind(revisions)
+		if err != nil {
+			httpErr(rw, "parsing revision scheme", err, http.StatusBadRequest)
+			return
+		}
+	}
 	err := q.CreateProject(project, name, desc)
 	if err != nil {
 		httpErr(rw, "creating project", err, http.StatusInternalServerError)
 		return
 	}
+	if kind != qap.RevisionQAP202 {
+		structure, err := q.GetStructure(project)
+		if err == nil {
+			structure.RevisionKind = kind
+			err = q.PutStructure(structure, changeNote{Comment: "revision scheme set to " + kind.String()})
+		}
+		if err != nil {
+			httpErr(rw, "setting project revision scheme", err, http.StatusInternalServerError)
+			return
+		}
+	}
 	fmt.Fprintf(rw, "project created")
 }
 
@@ -97,35 +136,48 @@ func (q *boltqap) handleAddDoc(rw http.ResponseWriter, r *http.Request) {
 
 func (q *boltqap) handleSearch(rw http.ResponseWriter, r *http.Request) {
 	hq := r.URL.Query()
-	query := strings.ToUpper(hq.Get("Query"))
-	if query == "" || len(query) > 22 {
+	query := strings.ToUpper(strings.TrimSpace(hq.Get("Query")))
+	if query == "" || len(query) > 128 {
 		httpErr(rw, "invalid query", nil, http.StatusBadRequest)
 		return
 	}
+	compiled, err := qap.ParseQuery(query)
+	if err != nil {
+		httpErr(rw, "parsing query "+query, err, http.StatusBadRequest)
+		return
+	}
 	perPage, _ := strconv.Atoi(hq.Get("PerPage"))
 	if perPage < 10 || perPage > 200 {
 		perPage = 40
 	}
+	cursor, err := qap.ParseCursor(hq.Get("After"))
+	if err != nil {
+		httpErr(rw, "invalid search cursor", err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("querying: %q after %q", query, cursor)
 	data := make([]qap.Header, perPage)
-	page, _ := strconv.Atoi(hq.Get("Page"))
-	log.Printf("querying: %q page %d", query, page)
-	n, total := q.filter.HumanQuery(data, query, page)
-	if n == 0 && total == 0 {
-		httpErr(rw, "query returned no results for "+query, nil, http.StatusBadRequest)
-		return
-	}
-	err := q.tmpl.Lookup("search.tmpl").Execute(rw, struct {
-		Page     int
-		PerPage  int
-		LastPage int
-		Headers  []qap.Header
-		Query    string
+	it := q.filter.Query(compiled)
+	it.Seek(cursor)
+	n, next := it.Next(data)
+	var suggestions []qap.Suggestion
+	if n == 0 && cursor.IsZero() {
+		suggestions = q.filter.Suggest(query, 5)
+	}
+	err = q.tmpl.Lookup("search.tmpl").Execute(rw, struct {
+		PerPage     int
+		Headers     []qap.Header
+		RawQuery    string
+		Suggestions []qap.Suggestion
+		IsFirst     bool
+		Next        string
 	}{
-		PerPage:  perPage,
-		Query:    url.QueryEscape(query),
-		Page:     page,
-		LastPage: total / perPage,
-		Headers:  data[:n],
+		PerPage:     perPage,
+		RawQuery:    query,
+		Headers:     data[:n],
+		Suggestions: suggestions,
+		IsFirst:     cursor.IsZero(),
+		Next:        next.String(),
 	})
 	if err != nil {
 		log.Println(err)
@@ -157,10 +209,12 @@ func (q *boltqap) handleLanding(rw http.ResponseWriter, r *http.Request) {
 		LastEditedDays int
 		Docs           []document
 		Projects       []qap.Project
+		Facets         qap.Facets
 	}{
 		LastEditedDays: lastEditedDays,
 		Docs:           documents,
 		Projects:       projects,
+		Facets:         q.filter.Facets(qap.Query{}, 1),
 	})
 }
 
@@ -169,8 +223,9 @@ func (q *boltqap) handleToCSV(rw http.ResponseWriter, r *http.Request) {
 	b := bytes.NewBuffer(make([]byte, 0, startCap))
 	w := csv.NewWriter(b)
 	w.Write(document{}.recordsHeader())
+	paths := q.equipmentPaths()
 	q.DoDocuments(func(d document) error {
-		w.Write(d.records())
+		w.Write(d.records(paths(d.Project, d.Equipment)))
 		return nil
 	})
 	w.Flush()
@@ -203,13 +258,19 @@ func (q *boltqap) handleImportCSV(rw http.ResponseWriter, r *http.Request) {
 	c := csv.NewReader(f)
 	expect := document{}.recordsHeader()
 	c.ReuseRecord = false
-	c.FieldsPerRecord = len(expect)
+	// Records must have as many fields as the header, which may lack
+	// the equipment path field if exported by a previous version.
+	c.FieldsPerRecord = 0
 	header, err := c.Read()
 	if err != nil {
 		httpErr(rw, "parsing csv header", err, http.StatusBadRequest)
 		return
 	}
-	for i := range expect {
+	if len(header) != len(expect) && len(header) != lenLegacyRecord {
+		httpErr(rw, fmt.Sprintf("expected csv header %q, got %q", strings.Join(expect, ","), strings.Join(header, ",")), nil, http.StatusBadRequest)
+		return
+	}
+	for i := range header {
 		if header[i] != expect[i] {
 			httpErr(rw, fmt.Sprintf("expected csv header %q, got %q", strings.Join(expect, ","), strings.Join(header, ",")), nil, http.StatusBadRequest)
 			return
@@ -260,10 +321,19 @@ func (b *boltqap) handleDocumentAction(rw http.ResponseWriter, r *http.Request,
 	action := query.Get("action")
 	switch action {
 	case "addRevision":
-		isRelease := query.Get("isrelease") == "on"
 		revStr := query.Get("rev")
 		description := query.Get("desc")
-		rev, err := qap.ParseRevision(revStr)
+		structure, err := b.GetStructure(doc.Project)
+		if err != nil {
+			httpErr(rw, "looking for project structure", err, http.StatusInternalServerError)
+			return
+		}
+		scheme := structure.RevisionScheme()
+		if scheme == nil {
+			httpErr(rw, "project has invalid revision scheme", nil, http.StatusInternalServerError)
+			return
+		}
+		rev, err := scheme.ParseRevision(revStr)
 		if err != nil {
 			httpErr(rw, "parsing revision \""+revStr+"\"", err, http.StatusBadRequest)
 			return
@@ -272,19 +342,79 @@ func (b *boltqap) handleDocumentAction(rw http.ResponseWriter, r *http.Request,
 			httpErr(rw, "empty description", nil, http.StatusBadRequest)
 			return
 		}
-		if isRelease && !rev.IsRelease {
-			httpErr(rw, "IsRelease form mismatch", nil, http.StatusBadRequest)
+		if rev.IsRelease {
+			// Releasing is done through lifecycle transitions and approvals.
+			httpErr(rw, "new revision "+rev.String()+" must be a draft, i.e. \""+rev.String()+"-draft\"", nil, http.StatusBadRequest)
 			return
 		}
-		rev.IsRelease = isRelease // override to draft status unless specified otherwise.
 		err = b.AddRevision(hd, revision{
 			Index:       rev,
 			Description: description,
+			State:       qap.StateInWork,
 		})
 		if err != nil {
 			httpErr(rw, "adding revision", err, http.StatusInternalServerError)
 			return
 		}
+	case "transition":
+		stateStr := query.Get("state")
+		state, err := qap.ParseState(stateStr)
+		if err != nil {
+			httpErr(rw, "parsing lifecycle state \""+stateStr+"\"", err, http.StatusBadRequest)
+			return
+		}
+		err = b.Transition(hd, state)
+		if err != nil {
+			httpErr(rw, "changing lifecycle state", err, http.StatusBadRequest)
+			return
+		}
+	case "submit":
+		reviewers := strings.Split(query.Get("reviewers"), ",")
+		err := b.SubmitForApproval(hd, reviewers)
+		if err != nil {
+			httpErr(rw, "submitting revision for approval", err, http.StatusBadRequest)
+			return
+		}
+	case "review":
+		decision := query.Get("decision")
+		if decision != string(decisionApproved) && decision != string(decisionRejected) {
+			httpErr(rw, "invalid review decision \""+decision+"\"", nil, http.StatusBadRequest)
+			return
+		}
+		reviewer := query.Get("reviewer")
+		if user := requester(r); user != "" {
+			if reviewer != "" && !strings.EqualFold(strings.TrimSpace(reviewer), user) {
+				httpErr(rw, "cannot review as \""+reviewer+"\" when signed in as \""+user+"\"", nil, http.StatusForbidden)
+				return
+			}
+			reviewer = user
+		}
+		err := b.Review(hd, reviewer, decision == string(decisionApproved), query.Get("comment"))
+		if err != nil {
+			httpErr(rw, "reviewing revision", err, http.StatusBadRequest)
+			return
+		}
+	case "edit":
+		edit, err := editDocumentFromForm(r)
+		if err != nil {
+			httpErr(rw, "parsing document edit form", err, http.StatusBadRequest)
+			return
+		}
+		doc, err = b.EditDocument(hd, edit)
+		if err != nil {
+			httpErr(rw, "editing document", err, http.StatusBadRequest)
+			return
+		}
+		hd, _ = doc.Header()
+	case "delete":
+		err := b.DeleteDocument(hd)
+		if err != nil {
+			httpErr(rw, "deleting document", err, http.StatusBadRequest)
+			return
+		}
+		log.Printf("document %s deleted", hd)
+		http.Redirect(rw, r, "/qap/structure?project="+doc.Project, http.StatusTemporaryRedirect)
+		return
 	case "addAttachment":
 		attachment, err := createDocumentFromForm(r)
 		if err != nil {
@@ -342,13 +472,90 @@ func (q *boltqap) handleProjectStructure(rw http.ResponseWriter, r *http.Request
 		q.handleAddEquipmentCode(rw, r, structure)
 		return
 	}
-	err = q.tmpl.Lookup("project.tmpl").Execute(rw, structure)
+	if action := r.FormValue("action"); action != "" {
+		q.handleEditStructure(rw, r, structure.Project(), action)
+		return
+	}
+	// Family facets count documents by the first two letters of their equipment code.
+	const familyPrefix = 2
+	facetQuery, err := qap.ParseQuery("P:" + structure.Project())
+	if err != nil {
+		httpErr(rw, "project facets query", err, http.StatusInternalServerError)
+		return
+	}
+	err = q.tmpl.Lookup("project.tmpl").Execute(rw, struct {
+		Structure qap.Project
+		Facets    qap.Facets
+	}{
+		Structure: structure,
+		Facets:    q.filter.Facets(facetQuery, familyPrefix),
+	})
 	if err != nil {
 		httpErr(rw, "template exec", err, http.StatusInternalServerError)
 		return
 	}
 }
 
+func (q *boltqap) handleEditStructure(rw http.ResponseWriter, r *http.Request, project, action string) {
+	code := r.FormValue("code")
+	force := r.FormValue("force") != ""
+	var edit func(p *qap.Project) (qap.Impact, error)
+	switch action {
+	case "rename":
+		name, desc := r.FormValue("name"), r.FormValue("desc")
+		if name != "" && reName.FindString(name) == "" {
+			httpErr(rw, "invalid name", nil, http.StatusBadRequest)
+			return
+		}
+		edit = func(p *qap.Project) (qap.Impact, error) {
+			return qap.Impact{}, p.RenameNode(code, name, desc)
+		}
+	case "recode":
+		newcode := r.FormValue("newcode")
+		if len(newcode) != 1 {
+			httpErr(rw, "new code must be a single letter", nil, http.StatusBadRequest)
+			return
+		}
+		edit = func(p *qap.Project) (qap.Impact, error) {
+			return p.RecodeNode(q.filter, code, newcode[0])
+		}
+	case "move":
+		parent := r.FormValue("parent")
+		edit = func(p *qap.Project) (qap.Impact, error) {
+			return p.MoveNode(q.filter, code, parent)
+		}
+	case "delete":
+		edit = func(p *qap.Project) (qap.Impact, error) {
+			return p.DeleteNode(q.filter, code)
+		}
+	case "addDocType":
+		dt := qap.DocumentType{Code: r.FormValue("doctype"), Name: r.FormValue("name"), Description: r.FormValue("desc")}
+		edit = func(p *qap.Project) (qap.Impact, error) {
+			return qap.Impact{}, p.AddDocumentType(dt)
+		}
+	case "restrictDocTypes":
+		var allowed []string
+		for _, dt := range strings.Split(r.FormValue("allowed"), ",") {
+			if dt = strings.TrimSpace(dt); dt != "" {
+				allowed = append(allowed, dt)
+			}
+		}
+		edit = func(p *qap.Project) (qap.Impact, error) {
+			return qap.Impact{}, p.RestrictDocumentTypes(code, allowed...)
+		}
+	default:
+		httpErr(rw, "structure action not found: "+action, nil, http.StatusBadRequest)
+		return
+	}
+	impact, err := q.EditStructure(project, changeNoteFromForm(r), force, edit)
+	if err != nil {
+		httpErr(rw, "editing project structure", err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("structure action %s on %s-%s: %s", action, project, code, impact)
+	http.Redirect(rw, r, "/qap/structure?project="+project, http.StatusSeeOther)
+}
+
 func (q *boltqap) handleAddEquipmentCode(rw http.ResponseWriter, r *http.Request, structure qap.Project) {
 	query := r.URL.Query()
 	code := query.Get("newcode")
@@ -364,7 +571,7 @@ func (q *boltqap) handleAddEquipmentCode(rw http.ResponseWriter, r *http.Request
 		httpErr(rw, "adding equipment code", err, http.StatusInternalServerError)
 		return
 	}
-	err = q.PutStructure(structure)
+	err = q.PutStructure(structure, changeNoteFromForm(r))
 	if err != nil {
 		httpErr(rw, "modifying project structure in DB", err, http.StatusInternalServerError)
 		return
@@ -372,3 +579,303 @@ func (q *boltqap) handleAddEquipmentCode(rw http.ResponseWriter, r *http.Request
 	log.Println("added ", accum+code, " to structure: ", structure)
 	http.Redirect(rw, r, "/qap/structure?project="+structure.Project(), http.StatusTemporaryRedirect)
 }
+
+// handleStructureBreakdown exports the project structure as a CSV or YAML
+// breakdown file on GET requests and previews or applies the import of an
+// uploaded breakdown file on POST requests.
+func (q *boltqap) handleStructureBreakdown(rw http.ResponseWriter, r *http.Request) {
+	project := r.FormValue("project")
+	format := r.FormValue("format")
+	if r.Method != http.MethodPost {
+		structure, err := q.GetStructure(project)
+		if err != nil {
+			httpErr(rw, "while looking for project structure", err, http.StatusBadRequest)
+			return
+		}
+		var b bytes.Buffer
+		if format == "yaml" {
+			err = qap.WriteBreakdownYAML(&b, structure.Breakdown())
+			rw.Header().Set("Content-Type", "application/yaml")
+		} else {
+			format = "csv"
+			err = qap.WriteBreakdownCSV(&b, structure.Breakdown())
+			rw.Header().Set("Content-Type", "text/csv")
+		}
+		if err != nil {
+			httpErr(rw, "encoding breakdown", err, http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Disposition", "attachment;filename=\""+project+"."+format+"\"")
+		rw.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+		io.Copy(rw, &b)
+		return
+	}
+	// The uploaded file is previewed first. The preview page posts
+	// the file contents back in the Content field to apply the import.
+	const megabyte = 1000 * 1000
+	content := r.FormValue("Content")
+	if content == "" {
+		err := r.ParseMultipartForm(megabyte)
+		if err != nil {
+			httpErr(rw, "parsing breakdown upload", err, http.StatusBadRequest)
+			return
+		}
+		files := r.MultipartForm.File["Breakdown"]
+		if len(files) != 1 {
+			httpErr(rw, "Breakdown file not found or too many files", nil, http.StatusBadRequest)
+			return
+		}
+		f, err := files[0].Open()
+		if err != nil {
+			httpErr(rw, "opening multipart form file", err, http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		b, err := io.ReadAll(io.LimitReader(f, megabyte+1))
+		if err != nil {
+			httpErr(rw, "reading breakdown file", err, http.StatusBadRequest)
+			return
+		}
+		content = string(b)
+		if ext := strings.ToLower(path.Ext(files[0].Filename)); ext == ".yaml" || ext == ".yml" {
+			format = "yaml"
+		}
+	}
+	if len(content) > megabyte {
+		// Larger files are rejected instead of being imported partially.
+		httpErr(rw, "breakdown file larger than 1MB", nil, http.StatusRequestEntityTooLarge)
+		return
+	}
+	var rows []qap.BreakdownRow
+	var err error
+	if format == "yaml" {
+		rows, err = qap.ReadBreakdownYAML(strings.NewReader(content))
+	} else {
+		format = "csv"
+		rows, err = qap.ReadBreakdownCSV(strings.NewReader(content))
+	}
+	var issues []qap.BreakdownIssue
+	var structure qap.Project
+	if err != nil {
+		issues = append(issues, qap.BreakdownIssue{Msg: err.Error()})
+		if issue, ok := err.(qap.BreakdownIssue); ok {
+			issues[0] = issue
+		}
+		structure, err = q.GetStructure(project)
+	} else {
+		apply := r.FormValue("apply") != ""
+		structure, issues, err = q.ImportStructure(project, changeNoteFromForm(r), rows, apply)
+		if err == nil && apply && len(issues) == 0 {
+			log.Printf("imported %d equipment codes to structure %s", len(rows), project)
+			http.Redirect(rw, r, "/qap/structure?project="+project, http.StatusSeeOther)
+			return
+		}
+	}
+	if err != nil {
+		httpErr(rw, "importing breakdown", err, http.StatusInternalServerError)
+		return
+	}
+	err = q.tmpl.Lookup("breakdown.tmpl").Execute(rw, struct {
+		Structure qap.Project
+		Rows      []qap.BreakdownRow
+		Issues    []qap.BreakdownIssue
+		Format    string
+		Content   string
+	}{
+		Structure: structure,
+		Rows:      rows,
+		Issues:    issues,
+		Format:    format,
+		Content:   content,
+	})
+	if err != nil {
+		httpErr(rw, "template exec", err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleStructureGraph serves the project structure annotated with document
+// counts as Graphviz DOT, Mermaid or plain text tree source. If the headers
+// query parameter is set the documents are drawn under their equipment node.
+func (q *boltqap) handleStructureGraph(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	structure, err := q.GetStructure(query.Get("project"))
+	if err != nil {
+		httpErr(rw, "while looking for project structure", err, http.StatusBadRequest)
+		return
+	}
+	var opts qap.GraphOptions
+	opts.Counts, err = structure.DocumentCounts(q.filter)
+	if err != nil {
+		httpErr(rw, "counting documents", err, http.StatusInternalServerError)
+		return
+	}
+	if query.Get("headers") != "" {
+		opts.Headers, err = structure.DocumentHeaders(q.filter)
+		if err != nil {
+			httpErr(rw, "listing documents", err, http.StatusInternalServerError)
+			return
+		}
+	}
+	var b bytes.Buffer
+	switch query.Get("format") {
+	case "", "dot":
+		rw.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		err = structure.WriteDOT(&b, opts)
+	case "mermaid":
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = structure.WriteMermaid(&b, opts)
+	case "text":
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = structure.WriteTree(&b, opts)
+	default:
+		httpErr(rw, "format must be dot, mermaid or text", nil, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		httpErr(rw, "writing structure graph", err, http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	io.Copy(rw, &b)
+}
+
+// handleStructureHistory lists the versions of a project structure and shows
+// the differences between versions from and to if both are set.
+func (q *boltqap) handleStructureHistory(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	project := query.Get("project")
+	versions, err := q.StructureHistory(project)
+	if err != nil {
+		httpErr(rw, "reading structure history", err, http.StatusBadRequest)
+		return
+	}
+	for i := range versions {
+		versions[i].Structure = qap.Project{} // Not shown.
+	}
+	var from, to structureVersion
+	var changes []qap.NodeChange
+	if query.Get("from") != "" && query.Get("to") != "" {
+		fromVersion, err := strconv.ParseUint(query.Get("from"), 10, 64)
+		if err != nil {
+			httpErr(rw, "parsing from version", err, http.StatusBadRequest)
+			return
+		}
+		toVersion, err := strconv.ParseUint(query.Get("to"), 10, 64)
+		if err != nil {
+			httpErr(rw, "parsing to version", err, http.StatusBadRequest)
+			return
+		}
+		from, err = q.GetStructureVersion(project, fromVersion)
+		if err == nil {
+			to, err = q.GetStructureVersion(project, toVersion)
+		}
+		if err != nil {
+			httpErr(rw, "looking for structure version", err, http.StatusBadRequest)
+			return
+		}
+		changes = qap.DiffProjects(from.Structure, to.Structure)
+	}
+	err = q.tmpl.Lookup("history.tmpl").Execute(rw, struct {
+		Project  string
+		Versions []structureVersion
+		From, To structureVersion
+		Changes  []qap.NodeChange
+	}{
+		Project:  project,
+		Versions: versions,
+		From:     from,
+		To:       to,
+		Changes:  changes,
+	})
+	if err != nil {
+		httpErr(rw, "template exec", err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// completion is the response of handleComplete.
+type completion struct {
+	// Code is the project and equipment code being completed, i.e. "LHC-MV".
+	// It may be followed by the document type code, i.e. "LHC-MV-DR".
+	Code string
+	// Valid is set if Code is a project and equipment code in the project
+	// structure followed by a document type allowed for the equipment, if any.
+	Valid bool
+	// Path is the human readable path of the equipment code.
+	Path  string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	// DocumentTypes are the document types allowed for documents
+	// with the equipment code. It is only set if Code is valid.
+	DocumentTypes []qap.DocumentType `json:",omitempty"`
+	Options       []completionOption
+}
+
+// completionOption is a code at the next level of a completion.
+type completionOption struct {
+	Code string
+	Name string
+}
+
+// handleComplete responds with the project codes or equipment codes at the next
+// level of the code query parameter as JSON. Completion proceeds one level at a
+// time: projects, systems, families, types, models and variants. Valid codes are
+// completed with the document types their documents may have.
+func (q *boltqap) handleComplete(rw http.ResponseWriter, r *http.Request) {
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	c := completion{Code: code, Options: []completionOption{}}
+	project, equipment, hasEquipment := strings.Cut(code, "-")
+	if !hasEquipment && len(project) < 3 {
+		q.DoProjects(func(structure qap.Project) error {
+			if strings.HasPrefix(structure.Project(), project) {
+				c.Options = append(c.Options, completionOption{Code: structure.Project() + "-", Name: structure.Name})
+			}
+			return nil
+		})
+	} else {
+		q.completeEquipment(&c, project, equipment)
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(rw).Encode(c)
+	if err != nil {
+		log.Println("encoding completion:", err)
+	}
+}
+
+func (q *boltqap) completeEquipment(c *completion, project, equipment string) {
+	structure, err := q.GetStructure(project)
+	if err != nil {
+		c.Error = "project " + project + " not found"
+		return
+	}
+	equipment, docType, hasDocType := strings.Cut(equipment, "-")
+	if equipment != "" {
+		nodes, err := structure.Resolve(equipment)
+		c.Path = qap.NodePath(nodes)
+		if err != nil {
+			c.Error = err.Error()
+			return
+		}
+	}
+	if hasDocType {
+		// Code is complete, i.e. "LHC-MV-DR".
+		err = structure.ValidateDocumentType(equipment, docType)
+		if err != nil {
+			c.Error = err.Error()
+			return
+		}
+		c.Valid = equipment != ""
+		return
+	}
+	if equipment != "" {
+		c.Valid = true
+		c.DocumentTypes, _ = structure.AllowedDocumentTypes(equipment)
+	}
+	children, err := structure.Complete(equipment)
+	if err != nil {
+		return // Last level.
+	}
+	for _, n := range children {
+		c.Options = append(c.Options, completionOption{Code: project + "-" + n.Code, Name: n.Name})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +18,19 @@ import (
 type revision struct {
 	Index       qap.Revision
 	Description string
+	// State is the lifecycle state of the revision. If zero
+	// the state is derived from the revision's release status.
+	State qap.State `json:",omitempty"`
+	// Approvals are the reviewer decisions on the revision.
+	Approvals []approval `json:",omitempty"`
+}
+
+// LifecycleState returns the lifecycle state of the revision.
+func (r revision) LifecycleState() qap.State {
+	if r.State == 0 {
+		return qap.StateOf(r.Index)
+	}
+	return r.State
 }
 
 type document struct {
@@ -57,6 +71,10 @@ func (doc document) ValidateForAdmission() (qap.DocInfo, error) {
 	return info, nil
 }
 
+// lenLegacyRecord is the amount of fields of CSV records
+// exported before the equipment path field was added.
+const lenLegacyRecord = 8
+
 func (d document) recordsHeader() []string {
 	return []string{
 		"doc#",
@@ -67,10 +85,13 @@ func (d document) recordsHeader() []string {
 		"revised",
 		"file-ext",
 		"location",
+		"equipment-path",
 	}
 }
 
-func (d document) records() []string {
+// records returns the document's CSV record. equipmentPath is the human readable
+// path of the document's equipment code in the project structure. See qap.NodePath.
+func (d document) records(equipmentPath string) []string {
 	return []string{
 		d.String(),
 		d.Version(),
@@ -80,11 +101,14 @@ func (d document) records() []string {
 		d.Revised.Format(timeKeyFormat),
 		d.FileExtension,
 		d.Location,
+		equipmentPath,
 	}
 }
 
+// docFromRecord parses a document from a CSV record. The equipment path
+// field is derived from the project structure and is ignored.
 func docFromRecord(record []string, ignoreTime bool) (document, error) {
-	if len(record) < len(document{}.recordsHeader()) {
+	if len(record) < lenLegacyRecord {
 		return document{}, errors.New("not enough record fields to parse document")
 	}
 	rec, err := qap.ParseHeader(record[0], false)
@@ -105,7 +129,8 @@ func docFromRecord(record []string, ignoreTime bool) (document, error) {
 			return document{}, errors.New("parsing doc record creation field: " + err.Error())
 		}
 	}
-	rev, err := qap.ParseRevision(record[1])
+	var rev qap.Revision
+	err = rev.UnmarshalText([]byte(record[1]))
 	if err != nil {
 		return document{}, err
 	}
@@ -150,9 +175,14 @@ func (d document) Info() (qap.DocInfo, error) {
 		return qap.DocInfo{}, err
 	}
 	r := d.Revision()
+	var state qap.State
+	if len(d.Revisions) > 0 {
+		state = d.Revisions[len(d.Revisions)-1].State
+	}
 	di := qap.DocInfo{
 		Header:       hd,
 		Revision:     r,
+		State:        state,
 		Creation:     d.Created,
 		RevisionTime: d.Revised,
 	}
@@ -170,6 +200,26 @@ func (d document) Revision() qap.Revision {
 	return d.Revisions[len(d.Revisions)-1].Index
 }
 
+// State returns the lifecycle state of the latest revision of the document.
+func (d document) State() qap.State {
+	if len(d.Revisions) == 0 {
+		return qap.StateOf(d.Revision())
+	}
+	return d.Revisions[len(d.Revisions)-1].LifecycleState()
+}
+
+// Transitions returns the lifecycle states the latest revision may transition to
+// outside of the approval workflow.
+func (d document) Transitions() []qap.State {
+	var states []qap.State
+	for _, state := range d.State().Transitions() {
+		if state != qap.StateUnderApproval && state != qap.StateReleased {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
 func (d *document) AddRevision(rev revision) error {
 	for i := range d.Revisions {
 		if d.Revisions[i].Index == rev.Index {
@@ -180,6 +230,24 @@ func (d *document) AddRevision(rev revision) error {
 	return nil
 }
 
+// RevisionHistory returns the revision indices of the document in the order they were added.
+func (d document) RevisionHistory() []qap.Revision {
+	history := make([]qap.Revision, len(d.Revisions))
+	for i := range d.Revisions {
+		history[i] = d.Revisions[i].Index
+	}
+	return history
+}
+
+// sortRevisions sorts the document revisions in ascending order and
+// validates the resulting revision history.
+func (d *document) sortRevisions() error {
+	sort.SliceStable(d.Revisions, func(i, j int) bool {
+		return qap.CompareRevisions(d.Revisions[i].Index, d.Revisions[j].Index) < 0
+	})
+	return qap.ValidateHistory(d.RevisionHistory())
+}
+
 func (d document) Version() string {
 	return d.Revision().String()
 }
@@ -214,12 +282,8 @@ func (d document) Header() (qap.Header, error) {
 	return qap.ParseHeader(fmt.Sprintf("%s-%s-%s-%d.%02d", d.Project, d.Equipment, d.DocType, d.Number, d.Attachment), false)
 }
 
-func (d *document) value() []byte {
-	b, err := json.Marshal(d)
-	if err != nil {
-		panic("unreachable")
-	}
-	return b
+func (d *document) value() ([]byte, error) {
+	return json.Marshal(d)
 }
 
 func consolidateMainDocumentVersions(documents []document) ([]document, error) {
@@ -249,6 +313,10 @@ func consolidateMainDocumentVersions(documents []document) ([]document, error) {
 	}
 	var newDocs []document
 	for _, d := range mdoc {
+		err := d.sortRevisions()
+		if err != nil {
+			return nil, fmt.Errorf("document %s revision history: %w", d.String(), err)
+		}
 		newDocs = append(newDocs, d)
 	}
 	return newDocs, nil
@@ -281,6 +349,7 @@ func checkConflicts(documents []document) error {
 
 type newDocForm struct {
 	Code          string
+	DocType       string // Appended to Code if set.
 	HumanName     string
 	SubmittedBy   string
 	FileExtension string
@@ -322,9 +391,13 @@ func createDocumentFromForm(r *http.Request) (document, error) {
 	if err != nil {
 		return document{}, err
 	}
-	prj, eq, dt := qap.ParseDocumentCodes(form.Code)
+	code := form.Code
+	if form.DocType != "" {
+		code += "-" + form.DocType
+	}
+	prj, eq, dt := qap.ParseDocumentCodes(code)
 	if prj == "" || eq == "" || dt == "" {
-		return document{}, err
+		return document{}, errors.New("invalid document codes " + code)
 	}
 	now := time.Now()
 	return document{
@@ -339,3 +412,31 @@ func createDocumentFromForm(r *http.Request) (document, error) {
 		Revised:       now,
 	}, nil
 }
+
+type editDocForm struct {
+	Code          string
+	HumanName     string
+	FileExtension string
+	Location      string
+}
+
+// editDocumentFromForm returns a document with the edited fields set.
+func editDocumentFromForm(r *http.Request) (document, error) {
+	var form editDocForm
+	err := bindFormToStruct(&form, r)
+	if err != nil {
+		return document{}, err
+	}
+	prj, eq, dt := qap.ParseDocumentCodes(form.Code)
+	if prj == "" || eq == "" || dt == "" {
+		return document{}, errors.New("invalid document code " + form.Code)
+	}
+	return document{
+		Project:       prj,
+		Equipment:     eq,
+		DocType:       dt,
+		HumanName:     form.HumanName,
+		FileExtension: form.FileExtension,
+		Location:      form.Location,
+	}, nil
+}
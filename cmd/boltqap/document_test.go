@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -30,7 +31,13 @@ func TestDocumentRecords(t *testing.T) {
 	if _, err := d.Info(); err != nil {
 		t.Fatal("test is incorrect:", err)
 	}
-	dpiped, err := docFromRecord(d.records(), false)
+	dpiped, err := docFromRecord(d.records("Hydraulics > Rotary > Cylinder"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDocEqual(t, d, dpiped)
+	// Records exported prior to the equipment path field.
+	dpiped, err = docFromRecord(d.records("")[:lenLegacyRecord], false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -40,7 +47,8 @@ func TestDocumentRecords(t *testing.T) {
 func assertDocEqual(t *testing.T, a, b document) error {
 	if len(a.Revisions) == len(b.Revisions) {
 		for i := range a.Revisions {
-			if a.Revisions[i] != b.Revisions[i] {
+			ra, rb := a.Revisions[i], b.Revisions[i]
+			if ra.Index != rb.Index || ra.Description != rb.Description || ra.State != rb.State || len(ra.Approvals) != len(rb.Approvals) {
 				t.Errorf("%dth revision not equal %s,%s", i, a.Revisions[i], b.Revisions[i])
 			}
 		}
@@ -88,3 +96,31 @@ func assertDocEqual(t *testing.T, a, b document) error {
 	}
 	return nil
 }
+
+func TestConsolidateSortsRevisions(t *testing.T) {
+	newDoc := func(rev string) document {
+		r, err := qap.ParseRevision(rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return document{Project: "SPS", Equipment: "HRC", DocType: "HP", Number: 1, Revisions: []revision{{Index: r}}}
+	}
+	docs, err := consolidateMainDocumentVersions([]document{newDoc("A.2"), newDoc("A.1-draft"), newDoc("B.0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 consolidated document, got %d", len(docs))
+	}
+	var got []string
+	for _, rev := range docs[0].Revisions {
+		got = append(got, rev.Index.String())
+	}
+	if strings.Join(got, ",") != "A.1-draft,A.2,B.0" {
+		t.Errorf("unexpected consolidated revisions %v", got)
+	}
+	_, err = consolidateMainDocumentVersions([]document{newDoc("A.2"), newDoc("A.4")})
+	if err == nil {
+		t.Error("expected error consolidating non-sequential revisions")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/soypat/go-qap"
+	"go.etcd.io/bbolt"
+)
+
+// Every structure stored by PutStructure is also stored as a version in the
+// history bucket nested in the project's metadata bucket, keyed by
+// big endian version number starting at 1.
+var historyBucket = []byte("history")
+
+// changeNote records who changed a project structure and why.
+type changeNote struct {
+	Author  string
+	Comment string
+}
+
+// changeNoteFromForm returns the change note of the author and comment form fields.
+func changeNoteFromForm(r *http.Request) changeNote {
+	return changeNote{Author: r.FormValue("author"), Comment: r.FormValue("comment")}
+}
+
+// structureVersion is a project structure as stored by PutStructure.
+type structureVersion struct {
+	Version   uint64
+	Author    string
+	Comment   string
+	Time      time.Time
+	Structure qap.Project
+}
+
+// Previous returns the number of the version preceding v, which is zero for the first version.
+func (v structureVersion) Previous() uint64 { return v.Version - 1 }
+
+// putStructureVersion stores structure as the next version in the history of
+// the project metadata bucket b. The structure stored before history was kept,
+// if any, is stored as the first version.
+func putStructureVersion(b *bbolt.Bucket, structure qap.Project, note changeNote, now time.Time) error {
+	h := b.Bucket(historyBucket)
+	if h == nil {
+		var err error
+		h, err = b.CreateBucket(historyBucket)
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte("structure")); v != nil {
+			var previous qap.Project
+			if err := json.Unmarshal(v, &previous); err != nil {
+				return err
+			}
+			err = putVersion(h, structureVersion{Comment: "structure prior to history", Structure: previous})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return putVersion(h, structureVersion{Author: note.Author, Comment: note.Comment, Time: now, Structure: structure})
+}
+
+func putVersion(h *bbolt.Bucket, version structureVersion) error {
+	seq, err := h.NextSequence()
+	if err != nil {
+		return err
+	}
+	version.Version = seq
+	val, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	return h.Put(versionKey(seq), val)
+}
+
+func versionKey(version uint64) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], version)
+	return key[:]
+}
+
+// StructureHistory returns the stored versions of the project structure, latest first.
+func (q *boltqap) StructureHistory(project string) (versions []structureVersion, err error) {
+	err = q.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("meta" + project))
+		if b == nil {
+			return errors.New("project metadata not found")
+		}
+		h := b.Bucket(historyBucket)
+		if h == nil {
+			return nil
+		}
+		c := h.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var version structureVersion
+			if err := json.Unmarshal(v, &version); err != nil {
+				return err
+			}
+			versions = append(versions, version)
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// GetStructureVersion returns the given version of the project structure.
+func (q *boltqap) GetStructureVersion(project string, version uint64) (sv structureVersion, err error) {
+	err = q.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("meta" + project))
+		if b == nil {
+			return errors.New("project metadata not found")
+		}
+		var v []byte
+		if h := b.Bucket(historyBucket); h != nil {
+			v = h.Get(versionKey(version))
+		}
+		if v == nil {
+			return fmt.Errorf("version %d of project %s structure not found", version, project)
+		}
+		return json.Unmarshal(v, &sv)
+	})
+	return sv, err
+}
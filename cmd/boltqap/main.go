@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/soypat/go-qap"
 )
@@ -55,8 +59,25 @@ func run() error {
 	sv.HandleFunc("/qap/downloadDB", db.handleDownloadDB)
 	sv.HandleFunc("/qap/doc/", db.handleGetDocument)
 	sv.HandleFunc("/qap/structure", db.handleProjectStructure)
+	sv.HandleFunc("/qap/structure/breakdown", db.handleStructureBreakdown)
+	sv.HandleFunc("/qap/structure/graph", db.handleStructureGraph)
+	sv.HandleFunc("/qap/structure/history", db.handleStructureHistory)
+	sv.HandleFunc("/qap/complete", db.handleComplete)
+	// Shut down gracefully on interrupt so that the database is closed
+	// and a header filter snapshot is stored for the next startup.
+	server := &http.Server{Addr: addr, Handler: sv}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
 	log.Println("Server running http://127.0.0.1" + addr)
-	return http.ListenAndServe(addr, sv)
+	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
 func httpErr(w http.ResponseWriter, msg string, err error, code int) {
@@ -70,6 +91,16 @@ func httpErr(w http.ResponseWriter, msg string, err error, code int) {
 	_htmlTemplates.Lookup("plain.tmpl").Execute(w, msg)
 }
 
+// requester returns the user name of the HTTP basic authentication credentials
+// of the request. boltqap does not authenticate users itself: the name can only
+// be trusted when boltqap is served behind a proxy that authenticates users.
+// Without such a proxy requester returns an empty string and reviewers are
+// free to review under any name.
+func requester(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return strings.TrimSpace(user)
+}
+
 // templating functions.
 var funcs = template.FuncMap{
 	"intRange": func(start, end int) []int {
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/soypat/go-qap"
+	"go.etcd.io/bbolt"
+)
+
+// The meta bucket holds a generation counter which is incremented by every
+// transaction that modifies documents and a snapshot of the header filter
+// tagged with the generation at which it was taken. A snapshot is stale
+// if its generation differs from the current generation. It also holds the
+// schema version of the stored documents.
+var (
+	metaBucket            = []byte("meta")
+	keySchemaVersion      = []byte("schema")
+	keyGeneration         = []byte("generation")
+	keySnapshot           = []byte("filter")
+	keySnapshotGeneration = []byte("filtergeneration")
+)
+
+// bumpGeneration increments the documents generation counter. It must be
+// called by every transaction that adds, modifies or removes documents.
+func bumpGeneration(tx *bbolt.Tx) error {
+	b, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	return putUint64(b, keyGeneration, getUint64(b, keyGeneration)+1)
+}
+
+// loadSnapshot returns the filter stored in the database or nil if there
+// is no snapshot or the snapshot is stale.
+func (q *boltqap) loadSnapshot() (*qap.SyncHeaderFilter, error) {
+	var filter *qap.SyncHeaderFilter
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(metaBucket)
+		if b == nil {
+			return nil
+		}
+		snapshot := b.Get(keySnapshot)
+		if snapshot == nil || getUint64(b, keySnapshotGeneration) != getUint64(b, keyGeneration) {
+			return nil
+		}
+		filter = qap.NewSyncHeaderFilter(nil)
+		return filter.UnmarshalBinary(snapshot)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// saveSnapshot stores a snapshot of the filter tagged with the current
+// generation. It must not be called while documents are being modified.
+func (q *boltqap) saveSnapshot() error {
+	snapshot, err := q.filter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		err = b.Put(keySnapshot, snapshot)
+		if err != nil {
+			return err
+		}
+		return putUint64(b, keySnapshotGeneration, getUint64(b, keyGeneration))
+	})
+}
+
+func getUint64(b *bbolt.Bucket, key []byte) uint64 {
+	v := b.Get(key)
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func putUint64(b *bbolt.Bucket, key []byte, v uint64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return b.Put(key, buf[:])
+}
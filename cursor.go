@@ -0,0 +1,126 @@
+package qap
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Cursor marks a position in the ordered results of a query so that
+// iteration may be resumed, i.e. in a later HTTP request. The zero value
+// Cursor is positioned at the start of the results.
+//
+// Cursors are positioned after a header and not at an index so resuming
+// is not affected by headers added to or removed from the filter.
+type Cursor struct {
+	after Header
+}
+
+// ParseCursor parses a cursor token as returned by Cursor.String.
+// An empty token yields the zero value Cursor.
+func ParseCursor(token string) (Cursor, error) {
+	if token == "" {
+		return Cursor{}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, errors.New("malformed cursor token")
+	}
+	var c Cursor
+	err = c.after.UnmarshalBinary(b)
+	if err != nil {
+		return Cursor{}, errors.New("malformed cursor token: " + err.Error())
+	}
+	return c, nil
+}
+
+// IsZero reports whether c is positioned at the start of the results.
+// Next returns a zero Cursor once there are no more results.
+func (c Cursor) IsZero() bool { return c.after == (Header{}) }
+
+// String returns an opaque URL safe token representing the cursor. The
+// zero value Cursor is represented by an empty string.
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	b, err := c.after.MarshalBinary()
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (c Cursor) MarshalText() ([]byte, error) { return []byte(c.String()), nil }
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (c *Cursor) UnmarshalText(text []byte) error {
+	cursor, err := ParseCursor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = cursor
+	return nil
+}
+
+// QueryIterator iterates over the headers of a filter matching a query
+// ordered by project, equipment, document type, number and attachment number.
+type QueryIterator struct {
+	hf *HeaderFilter
+	// lock is held during calls to Next if not nil.
+	lock   sync.Locker
+	q      Query
+	cursor Cursor
+	done   bool
+}
+
+// Query returns an iterator over the headers in the filter matching q.
+func (hf *HeaderFilter) Query(q Query) *QueryIterator {
+	return &QueryIterator{hf: hf, q: q}
+}
+
+// Seek positions the iterator at c so that the next call to Next
+// returns the results following those of the call which returned c.
+func (it *QueryIterator) Seek(c Cursor) {
+	it.cursor = c
+	it.done = false
+}
+
+// Next stores the following matches of the query in dst and returns the amount
+// stored. If there are more matches left it returns a non-zero cursor that
+// may be used to resume iteration with Seek. The cost of Next is proportional
+// to the headers visited to fill dst and not to the position in the results.
+func (it *QueryIterator) Next(dst []Header) (n int, cursor Cursor) {
+	if it.done || len(dst) == 0 {
+		return 0, Cursor{}
+	}
+	if it.lock != nil {
+		it.lock.Lock()
+		defer it.lock.Unlock()
+	}
+	hf := it.hf
+	lo, hi := hf.prefixRange(it.q.prefix())
+	if !it.cursor.IsZero() {
+		after := it.cursor.after
+		lo += sort.Search(hi-lo, func(i int) bool {
+			return compareHeaders(hf.data[hf.sorted[lo+i]], after) > 0
+		})
+	}
+	for _, i := range hf.sorted[lo:hi] {
+		if hf.deleted[i] || !it.q.Match(hf.data[i]) {
+			continue
+		}
+		if n == len(dst) {
+			// There are matches left after the last stored header.
+			it.cursor = Cursor{after: dst[n-1]}
+			return n, it.cursor
+		}
+		dst[n] = hf.data[i]
+		n++
+	}
+	it.done = true
+	it.cursor = Cursor{}
+	return n, Cursor{}
+}
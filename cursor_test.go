@@ -0,0 +1,63 @@
+package qap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestQueryIteratorPagination(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(5)), 2000)
+	sf := NewSyncHeaderFilter(headers[:1000])
+	q, err := ParseQuery("LHC-M*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []Header
+	page := make([]Header, 7)
+	var cursor Cursor
+	for pages := 0; ; pages++ {
+		// Resume from the cursor token as a new request would.
+		resumed, err := ParseCursor(cursor.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		it := sf.Query(q)
+		it.Seek(resumed)
+		n, next := it.Next(page)
+		all = append(all, page[:n]...)
+		if pages == 3 {
+			// Headers added between requests do not shift later pages.
+			for _, hd := range headers[1000:] {
+				if err := sf.AddHeader(hd); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if next.IsZero() {
+			if n == 0 && pages > 0 {
+				t.Error("non-zero cursor returned before empty page")
+			}
+			break
+		}
+		cursor = next
+	}
+	for i := 1; i < len(all); i++ {
+		if compareHeaders(all[i-1], all[i]) >= 0 {
+			t.Fatalf("results not strictly ordered: %s, %s", all[i-1], all[i])
+		}
+	}
+	// Headers added after the fourth page are only seen if they follow it.
+	last := all[4*len(page)-1]
+	expect := 0
+	for i, hd := range headers {
+		if q.Match(hd) && (i < 1000 || compareHeaders(hd, last) > 0) {
+			expect++
+		}
+	}
+	if len(all) != expect {
+		t.Errorf("expected %d results, got %d", expect, len(all))
+	}
+	if _, err := ParseCursor("not a cursor"); err == nil {
+		t.Error("expected error parsing malformed cursor")
+	}
+}
@@ -0,0 +1,94 @@
+package qap
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NodeChangeKind is the kind of change made to a node of a project's equipment structure.
+type NodeChangeKind uint8
+
+const (
+	NodeAdded NodeChangeKind = iota + 1
+	NodeRemoved
+	// NodeRenamed is a change of the name or description of a node.
+	NodeRenamed
+)
+
+func (k NodeChangeKind) String() string {
+	switch k {
+	case NodeAdded:
+		return "added"
+	case NodeRemoved:
+		return "removed"
+	case NodeRenamed:
+		return "renamed"
+	}
+	return "<invalid change>"
+}
+
+// NodeChange is a difference between two versions of a project structure.
+type NodeChange struct {
+	Kind NodeChangeKind
+	// Old is the zero value for added nodes and New the zero value for removed nodes.
+	Old, New Node
+}
+
+// Code returns the equipment code of the changed node.
+func (c NodeChange) Code() string {
+	if c.Kind == NodeAdded {
+		return c.New.Code
+	}
+	return c.Old.Code
+}
+
+func (c NodeChange) String() string {
+	switch c.Kind {
+	case NodeAdded:
+		return fmt.Sprintf("added %s %s %q", c.New.Level, c.New.Code, c.New.Name)
+	case NodeRemoved:
+		return fmt.Sprintf("removed %s %s %q", c.Old.Level, c.Old.Code, c.Old.Name)
+	}
+	return fmt.Sprintf("renamed %s %s %q to %q", c.New.Level, c.New.Code, c.Old.Name, c.New.Name)
+}
+
+// DiffProjects returns the nodes added, removed and renamed in the equipment
+// structure of to with respect to from ordered by equipment code. Nodes are
+// matched by equipment code so a recoded or moved node is reported as removed
+// and added along with all of its children. Serial ranges are compared as
+// nodes with their pattern as code, see SerialRange.Pattern.
+func DiffProjects(from, to Project) []NodeChange {
+	old := make(map[string]Node)
+	for _, n := range from.diffNodes() {
+		old[n.Code] = n
+	}
+	var changes []NodeChange
+	for _, n := range to.diffNodes() {
+		o, ok := old[n.Code]
+		switch {
+		case !ok:
+			changes = append(changes, NodeChange{Kind: NodeAdded, New: n})
+		case o.Name != n.Name || o.Description != n.Description:
+			changes = append(changes, NodeChange{Kind: NodeRenamed, Old: o, New: n})
+		}
+		delete(old, n.Code)
+	}
+	for _, o := range old {
+		changes = append(changes, NodeChange{Kind: NodeRemoved, Old: o})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Code() < changes[j].Code() })
+	return changes
+}
+
+// diffNodes returns the nodes and serial ranges of the project structure.
+func (p Project) diffNodes() []Node {
+	var nodes []Node
+	p.Walk(func(n Node) error {
+		nodes = append(nodes, n)
+		return nil
+	})
+	for _, sr := range p.Serials {
+		nodes = append(nodes, Node{Level: NodeLevel(len(sr.Prefix) + sr.Digits), Code: sr.Pattern(), Name: sr.Name, Description: sr.Description})
+	}
+	return nodes
+}
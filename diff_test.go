@@ -0,0 +1,50 @@
+package qap
+
+import "testing"
+
+func TestDiffProjects(t *testing.T) {
+	from := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MB", "X"} {
+		if err := from.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	to := from.clone()
+	if err := to.RenameNode("MV", "Vacuum", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := to.DeleteNode(nil, "X"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := to.RecodeNode(nil, "MB", 'C'); err != nil {
+		t.Fatal(err)
+	}
+	if err := to.AddEquipmentCode("MVRA", "model", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	changes := DiffProjects(from, to)
+	want := []struct {
+		kind NodeChangeKind
+		code string
+	}{
+		{NodeRemoved, "MB"},
+		{NodeAdded, "MC"},
+		{NodeRenamed, "MV"},
+		{NodeAdded, "MVRA"},
+		{NodeRemoved, "X"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %v", len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].Kind != w.kind || changes[i].Code() != w.code {
+			t.Errorf("change %d: want %s %s, got %s", i, w.kind, w.code, changes[i])
+		}
+	}
+	if changes[2].Old.Name != "name" || changes[2].New.Name != "Vacuum" {
+		t.Errorf("unexpected rename %s", changes[2])
+	}
+	if len(DiffProjects(to, to)) != 0 {
+		t.Error("expected no changes between equal structures")
+	}
+}
@@ -0,0 +1,237 @@
+package qap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DocumentType describes the meaning of a document type code.
+type DocumentType struct {
+	Code        string
+	Name        string
+	Description string `json:",omitempty"`
+}
+
+func (dt DocumentType) String() string {
+	if dt.Name == "" {
+		return dt.Code
+	}
+	return dt.Code + " - " + dt.Name
+}
+
+// Validate tests the document type for malformed data.
+func (dt DocumentType) Validate() error {
+	if len(dt.Code) == 0 || len(dt.Code) > lenDT || validQAPAlpha([]byte(dt.Code)) != dt.Code {
+		return ErrBadDocumentTypeCode
+	}
+	if dt.Name == "" {
+		return fmt.Errorf("document type %s has no name", dt.Code)
+	}
+	return nil
+}
+
+// qap202DocumentTypes are the document types bundled with the package.
+var qap202DocumentTypes = []DocumentType{
+	{Code: "CA", Name: "Calculation"},
+	{Code: "CR", Name: "Change Request"},
+	{Code: "DR", Name: "Drawing"},
+	{Code: "ES", Name: "Engineering Specification"},
+	{Code: "FS", Name: "Functional Specification"},
+	{Code: "IP", Name: "Inspection Plan"},
+	{Code: "IS", Name: "Interface Specification"},
+	{Code: "MM", Name: "Minutes of Meeting"},
+	{Code: "MP", Name: "Manufacturing Procedure"},
+	{Code: "NC", Name: "Non-Conformity Report"},
+	{Code: "PM", Name: "Project Management"},
+	{Code: "QA", Name: "Quality Assurance"},
+	{Code: "RP", Name: "Report"},
+	{Code: "TP", Name: "Test Procedure"},
+	{Code: "TR", Name: "Test Report"},
+	{Code: "TS", Name: "Technical Specification"},
+}
+
+// QAP202DocumentTypes returns the standard document types bundled with the package.
+func QAP202DocumentTypes() []DocumentType {
+	return append([]DocumentType{}, qap202DocumentTypes...)
+}
+
+// DocumentTypeRegistry is a set of known document type codes. The zero value
+// is an empty registry ready for use.
+type DocumentTypeRegistry struct {
+	types map[string]DocumentType
+}
+
+// NewDocumentTypeRegistry returns a registry containing the standard
+// QAP202 document types and the argument document types.
+func NewDocumentTypeRegistry(types ...DocumentType) (*DocumentTypeRegistry, error) {
+	r := &DocumentTypeRegistry{}
+	for _, dt := range append(QAP202DocumentTypes(), types...) {
+		if err := r.Register(dt); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a document type to the registry. Registering an existing
+// code returns an error.
+func (r *DocumentTypeRegistry) Register(dt DocumentType) error {
+	if err := dt.Validate(); err != nil {
+		return err
+	}
+	if existing, ok := r.types[dt.Code]; ok {
+		return fmt.Errorf("document type %s already registered", existing)
+	}
+	if r.types == nil {
+		r.types = make(map[string]DocumentType)
+	}
+	r.types[dt.Code] = dt
+	return nil
+}
+
+// Lookup returns the registered document type with the given code.
+func (r *DocumentTypeRegistry) Lookup(code string) (DocumentType, bool) {
+	dt, ok := r.types[code]
+	return dt, ok
+}
+
+// Types returns the registered document types ordered by code.
+func (r *DocumentTypeRegistry) Types() []DocumentType {
+	types := make([]DocumentType, 0, len(r.types))
+	for _, dt := range r.types {
+		types = append(types, dt)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Code < types[j].Code })
+	return types
+}
+
+// DocumentTypeRule restricts the document types of documents with
+// equipment codes starting with Equipment, a system or family code.
+type DocumentTypeRule struct {
+	Equipment string
+	Allowed   []string
+}
+
+// DocumentTypeRegistry returns the registry of document types available to
+// the project's documents, which are the standard QAP202 document types and
+// the project's own. See AddDocumentType.
+func (p Project) DocumentTypeRegistry() (*DocumentTypeRegistry, error) {
+	return NewDocumentTypeRegistry(p.DocumentTypes...)
+}
+
+// AddDocumentType registers a document type for the project's documents.
+func (p *Project) AddDocumentType(dt DocumentType) error {
+	registry, err := p.DocumentTypeRegistry()
+	if err != nil {
+		return err
+	}
+	if err := registry.Register(dt); err != nil {
+		return err
+	}
+	p.DocumentTypes = append(p.DocumentTypes, dt)
+	return nil
+}
+
+// RestrictDocumentTypes restricts the document types of documents with
+// equipment codes under the system or family equipment to the allowed codes.
+// Restricting an equipment code again replaces its previous restriction and
+// calling RestrictDocumentTypes without allowed codes removes it.
+func (p *Project) RestrictDocumentTypes(equipment string, allowed ...string) error {
+	if len(equipment) > 2 {
+		return fmt.Errorf("document types may only be restricted per system or family, got %q", equipment)
+	}
+	if _, err := p.node(equipment); err != nil {
+		return err
+	}
+	registry, err := p.DocumentTypeRegistry()
+	if err != nil {
+		return err
+	}
+	for _, code := range allowed {
+		if _, ok := registry.Lookup(code); !ok {
+			return fmt.Errorf("%w %q", ErrUnknownDocumentType, code)
+		}
+	}
+	rules := p.DocumentTypeRules[:0]
+	for _, rule := range p.DocumentTypeRules {
+		if rule.Equipment != equipment {
+			rules = append(rules, rule)
+		}
+	}
+	if len(allowed) > 0 {
+		rules = append(rules, DocumentTypeRule{Equipment: equipment, Allowed: append([]string{}, allowed...)})
+	}
+	p.DocumentTypeRules = rules
+	return nil
+}
+
+// rekeyDocumentTypeRules replaces the equipment code prefix from with to in
+// the document type rules under the node from so that rules follow their node
+// when it is recoded or moved. If to is empty the rules are removed.
+func (p *Project) rekeyDocumentTypeRules(from, to string) {
+	var rules []DocumentTypeRule
+	for _, rule := range p.DocumentTypeRules {
+		if strings.HasPrefix(rule.Equipment, from) {
+			if to == "" {
+				continue
+			}
+			rule.Equipment = to + rule.Equipment[len(from):]
+		}
+		rules = append(rules, rule)
+	}
+	p.DocumentTypeRules = rules
+}
+
+// AllowedDocumentTypes returns the document types allowed for documents with
+// the given equipment code ordered by code. The rule of the family takes
+// precedence over the rule of the system. Without rules all of the project's
+// document types are allowed.
+func (p Project) AllowedDocumentTypes(equipment string) ([]DocumentType, error) {
+	registry, err := p.DocumentTypeRegistry()
+	if err != nil {
+		return nil, err
+	}
+	var rule *DocumentTypeRule
+	for i := range p.DocumentTypeRules {
+		r := &p.DocumentTypeRules[i]
+		if strings.HasPrefix(equipment, r.Equipment) && (rule == nil || len(r.Equipment) > len(rule.Equipment)) {
+			rule = r
+		}
+	}
+	if rule == nil {
+		return registry.Types(), nil
+	}
+	allowed := make([]DocumentType, 0, len(rule.Allowed))
+	for _, code := range rule.Allowed {
+		if dt, ok := registry.Lookup(code); ok {
+			allowed = append(allowed, dt)
+		}
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i].Code < allowed[j].Code })
+	return allowed, nil
+}
+
+// ValidateDocumentType tests whether documents with the given equipment
+// code may have the document type docType in the project. Document types
+// are only enforced once the project has its own document types or rules,
+// so that projects predating document types keep accepting their codes.
+func (p Project) ValidateDocumentType(equipment, docType string) error {
+	if len(p.DocumentTypes) == 0 && len(p.DocumentTypeRules) == 0 {
+		return nil
+	}
+	allowed, err := p.AllowedDocumentTypes(equipment)
+	if err != nil {
+		return err
+	}
+	for _, dt := range allowed {
+		if dt.Code == docType {
+			return nil
+		}
+	}
+	registry, _ := p.DocumentTypeRegistry()
+	if _, ok := registry.Lookup(docType); !ok {
+		return fmt.Errorf("%w %q in project %s", ErrUnknownDocumentType, docType, p)
+	}
+	return fmt.Errorf("document type %s not allowed for equipment %s in project %s", docType, equipment, p)
+}
@@ -0,0 +1,148 @@
+package qap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDocumentTypeRegistry(t *testing.T) {
+	r, err := NewDocumentTypeRegistry(DocumentType{Code: "HP", Name: "Hydraulic Plan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt, ok := r.Lookup("QA"); !ok || dt.Name != "Quality Assurance" {
+		t.Errorf("expected standard QA document type, got %v", dt)
+	}
+	if _, ok := r.Lookup("HP"); !ok {
+		t.Error("expected registered HP document type")
+	}
+	types := r.Types()
+	if len(types) != len(qap202DocumentTypes)+1 {
+		t.Errorf("expected %d document types, got %d", len(qap202DocumentTypes)+1, len(types))
+	}
+	for i := 1; i < len(types); i++ {
+		if types[i-1].Code >= types[i].Code {
+			t.Errorf("document types not ordered: %s, %s", types[i-1], types[i])
+		}
+	}
+	for _, bad := range []DocumentType{{Code: "QA", Name: "again"}, {Code: "qa", Name: "lower"}, {Code: "ABC", Name: "long"}, {Code: "ZZ"}} {
+		if err := r.Register(bad); err == nil {
+			t.Errorf("expected error registering %+v", bad)
+		}
+	}
+}
+
+func TestProjectDocumentTypes(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MB", "X"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Projects without document type configuration accept any code.
+	if err := p.ValidateDocumentType("X", "ZZ"); err != nil {
+		t.Errorf("expected unconfigured project to accept any document type, got %v", err)
+	}
+	if err := p.AddDocumentType(DocumentType{Code: "HP", Name: "Hydraulic Plan"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddDocumentType(DocumentType{Code: "DR", Name: "Drawing again"}); err == nil {
+		t.Error("expected error adding standard document type")
+	}
+	if err := p.RestrictDocumentTypes("M", "DR", "QA", "HP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RestrictDocumentTypes("MV", "HP"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]string{{"MVR", "HP"}, {"Z", "HP"}, {"X", "ZZ"}} {
+		if err := p.RestrictDocumentTypes(bad[0], bad[1:]...); err == nil {
+			t.Errorf("expected error restricting %v", bad)
+		}
+	}
+	for _, test := range []struct {
+		equipment, docType string
+		ok                 bool
+	}{
+		{"X", "TS", true},
+		{"X", "HP", true},
+		{"M", "QA", true},
+		{"MB", "DR", true},
+		{"M", "TS", false},
+		{"MV", "HP", true},
+		{"MVR", "HP", true},
+		{"MVR", "QA", false},
+		{"X", "ZZ", false},
+	} {
+		err := p.ValidateDocumentType(test.equipment, test.docType)
+		if (err == nil) != test.ok {
+			t.Errorf("%s %s: expected ok=%t, got %v", test.equipment, test.docType, test.ok, err)
+		}
+	}
+	if err := p.ValidateDocumentType("X", "ZZ"); !errors.Is(err, ErrUnknownDocumentType) {
+		t.Errorf("expected unknown document type error, got %v", err)
+	}
+	// Removing the family rule falls back to the system rule.
+	if err := p.RestrictDocumentTypes("MV"); err != nil {
+		t.Fatal(err)
+	}
+	allowed, _ := p.AllowedDocumentTypes("MVR")
+	if len(allowed) != 3 || allowed[0].Code != "DR" {
+		t.Errorf("expected system rule document types, got %v", allowed)
+	}
+}
+
+func TestProjectEditNodesDocumentTypes(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "X", "Y"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.RestrictDocumentTypes("M", "DR"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RestrictDocumentTypes("MV", "QA"); err != nil {
+		t.Fatal(err)
+	}
+	// Rules follow their node when it is recoded or moved.
+	if _, err := p.RecodeNode(nil, "M", 'N'); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.MoveNode(nil, "NV", "X"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		equipment, docType string
+		ok                 bool
+	}{
+		{"N", "DR", true},
+		{"N", "QA", false},
+		{"XV", "QA", true},
+		{"XV", "DR", false},
+		{"X", "DR", true},
+		{"M", "QA", true},
+	} {
+		err := p.ValidateDocumentType(test.equipment, test.docType)
+		if (err == nil) != test.ok {
+			t.Errorf("%s %s: expected ok=%t, got %v", test.equipment, test.docType, test.ok, err)
+		}
+	}
+	// Rules are deleted along with their node and are not
+	// inherited by a node later added with the same code.
+	if _, err := p.DeleteNode(nil, "X"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddEquipmentCode("X", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddEquipmentCode("XV", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ValidateDocumentType("XV", "DR"); err != nil {
+		t.Errorf("expected rule of deleted node removed, got %v", err)
+	}
+	if len(p.DocumentTypeRules) != 1 || p.DocumentTypeRules[0].Equipment != "N" {
+		t.Errorf("unexpected document type rules %v", p.DocumentTypeRules)
+	}
+}
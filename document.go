@@ -41,6 +41,9 @@ func ParseDocumentName(docName string) (Header, Revision, error) {
 type DocInfo struct {
 	Header
 	Revision Revision
+	// Lifecycle state of the revision. If zero the state is derived
+	// from the revision's release status. See LifecycleState.
+	State State
 	// Time document was created.
 	Creation time.Time
 	// Time revision index was last incremented.
@@ -65,8 +68,41 @@ func (d DocInfo) Validate() error {
 	if err := d.Revision.Validate(); err != nil {
 		return err
 	}
+	if d.State != 0 {
+		if err := d.State.Validate(); err != nil {
+			return err
+		}
+		if d.State.IsRelease() != d.Revision.IsRelease {
+			return fmt.Errorf("lifecycle state %s does not match revision %s", d.State, d.Revision)
+		}
+	}
 	if d.Creation == (time.Time{}) || d.RevisionTime == (time.Time{}) {
 		return ErrZeroTime
 	}
 	return nil
 }
+
+// LifecycleState returns the lifecycle state of the document's revision.
+func (d DocInfo) LifecycleState() State {
+	if d.State == 0 {
+		return StateOf(d.Revision)
+	}
+	return d.State
+}
+
+// Transition returns the DocInfo with its lifecycle state changed to the
+// state to. The revision's release status is updated to match the new state.
+// It returns an error if the transition is not allowed or if the resulting
+// revision is invalid, i.e. releasing a QAP202 "A.1" revision.
+func (d DocInfo) Transition(to State) (DocInfo, error) {
+	state, err := d.LifecycleState().Transition(to)
+	if err != nil {
+		return DocInfo{}, err
+	}
+	d.State = state
+	d.Revision.IsRelease = state.IsRelease()
+	if err := d.Revision.Validate(); err != nil {
+		return DocInfo{}, err
+	}
+	return d, nil
+}
@@ -0,0 +1,557 @@
+package qap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Binary format versions. The version is the first byte of every
+// binary encoded value so that the layout may evolve without
+// breaking data that is already persisted.
+const (
+	headerBinaryVersion   = 1
+	revisionBinaryVersion = 1
+	docInfoBinaryVersion  = 1
+	filterBinaryVersion   = 1
+
+	// Length of a binary encoded Revision. See Revision.MarshalBinary.
+	lenRevision = 1 + 1 + 2 + 1
+	// Minimum length of a binary encoded DocInfo.
+	minLenDocInfo = 1 + lenHeader + lenRevision + 1 + 2
+	// Length of a binary encoded HeaderFilter without headers.
+	lenFilterPrefix = 1 + 4 + 4
+)
+
+const revisionFlagRelease = 1 << 0
+
+var errBadBinaryVersion = errors.New("unsupported binary format version")
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// The Header is encoded as a fixed length byte array with the layout:
+//
+//	offset  size  field
+//	0       1     format version (1)
+//	1       4     project code, zero padded
+//	5       5     equipment code, zero padded
+//	10      3     document type code, zero padded
+//	13      4     number, big endian
+//	17      1     attachment number
+//
+// Byte-wise comparison of two encoded headers yields the same order as
+// comparing project, equipment, document type, number and attachment number
+// in that order, which makes encoded headers suitable as sortable database keys.
+func (h Header) MarshalBinary() ([]byte, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	b := make([]byte, lenHeader)
+	err := h.puts(b)
+	return b, err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It
+// expects data as returned by MarshalBinary and validates the result.
+func (h *Header) UnmarshalBinary(data []byte) error {
+	if len(data) != lenHeader {
+		return fmt.Errorf("binary header must be %d bytes long, got %d", lenHeader, len(data))
+	}
+	hd, err := headerGets(data)
+	if err != nil {
+		return err
+	}
+	*h = hd
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// The Revision is encoded as a format version byte followed by the
+// revision kind, the two revision index bytes and a flag byte indicating
+// release status. Encoded QAP202 and numeric revisions sort in ascending order.
+func (r Revision) MarshalBinary() ([]byte, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	b := make([]byte, lenRevision)
+	err := r.puts(b)
+	return b, err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It
+// expects data as returned by MarshalBinary and validates the result.
+func (r *Revision) UnmarshalBinary(data []byte) error {
+	if len(data) != lenRevision {
+		return fmt.Errorf("binary revision must be %d bytes long, got %d", lenRevision, len(data))
+	}
+	rev, err := revisionGets(data)
+	if err != nil {
+		return err
+	}
+	*r = rev
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// The DocInfo is encoded as a format version byte followed by the binary
+// encoded Header and Revision and a byte with the lifecycle state. The
+// creation and revision times follow, each prefixed by a single byte
+// indicating their length.
+func (d DocInfo) MarshalBinary() ([]byte, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	creation, err := d.Creation.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	revised, err := d.RevisionTime.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 1+lenHeader+lenRevision, minLenDocInfo+len(creation)+len(revised))
+	b[0] = docInfoBinaryVersion
+	if err := d.Header.puts(b[1:]); err != nil {
+		return nil, err
+	}
+	if err := d.Revision.puts(b[1+lenHeader:]); err != nil {
+		return nil, err
+	}
+	b = append(b, byte(d.State))
+	b = append(b, byte(len(creation)))
+	b = append(b, creation...)
+	b = append(b, byte(len(revised)))
+	b = append(b, revised...)
+	return b, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It
+// expects data as returned by MarshalBinary and validates the result.
+func (d *DocInfo) UnmarshalBinary(data []byte) error {
+	if len(data) < minLenDocInfo {
+		return errors.New("binary document info too short")
+	}
+	if data[0] != docInfoBinaryVersion {
+		return errBadBinaryVersion
+	}
+	hd, err := headerGets(data[1 : 1+lenHeader])
+	if err != nil {
+		return err
+	}
+	rev, err := revisionGets(data[1+lenHeader : 1+lenHeader+lenRevision])
+	if err != nil {
+		return err
+	}
+	rest := data[1+lenHeader+lenRevision:]
+	state, rest := State(rest[0]), rest[1:]
+	creation, rest, err := timeGets(rest)
+	if err != nil {
+		return fmt.Errorf("decoding creation time: %w", err)
+	}
+	revised, rest, err := timeGets(rest)
+	if err != nil {
+		return fmt.Errorf("decoding revision time: %w", err)
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data after binary document info")
+	}
+	di := DocInfo{
+		Header:       hd,
+		Revision:     rev,
+		State:        state,
+		Creation:     creation,
+		RevisionTime: revised,
+	}
+	if err := di.Validate(); err != nil {
+		return err
+	}
+	*d = di
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The
+// filter is encoded as a snapshot of the headers it contains with the layout:
+//
+//	offset     size  field
+//	0          1     format version (1)
+//	1          4     amount of headers n, big endian
+//	5          4     amount of retired headers m, big endian
+//	9          18*n  binary encoded headers in ascending order
+//	9+18*n     18*m  binary encoded retired headers in ascending order
+//
+// Removed headers and numbering policies are not encoded.
+func (hf *HeaderFilter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, lenFilterPrefix, lenFilterPrefix+lenHeader*(hf.Len()+len(hf.retired)))
+	b[0] = filterBinaryVersion
+	binary.BigEndian.PutUint32(b[1:], uint32(hf.Len()))
+	binary.BigEndian.PutUint32(b[5:], uint32(len(hf.retired)))
+	for _, i := range hf.sorted {
+		if hf.deleted[i] {
+			continue
+		}
+		b = b[:len(b)+lenHeader]
+		if err := hf.data[i].puts(b[len(b)-lenHeader:]); err != nil {
+			return nil, err
+		}
+	}
+	for _, hd := range hf.retired {
+		b = b[:len(b)+lenHeader]
+		if err := hd.puts(b[len(b)-lenHeader:]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It
+// replaces the headers in the filter with those of a snapshot as returned by
+// MarshalBinary. Numbering policies set on the filter are kept.
+func (hf *HeaderFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < lenFilterPrefix {
+		return errors.New("binary header filter too short")
+	}
+	if data[0] != filterBinaryVersion {
+		return errBadBinaryVersion
+	}
+	n := int(binary.BigEndian.Uint32(data[1:]))
+	m := int(binary.BigEndian.Uint32(data[5:]))
+	if len(data) != lenFilterPrefix+(n+m)*lenHeader {
+		return fmt.Errorf("binary header filter of %d headers must be %d bytes long, got %d", n+m, lenFilterPrefix+(n+m)*lenHeader, len(data))
+	}
+	headers := make([]Header, n+m)
+	for i := range headers {
+		offset := lenFilterPrefix + i*lenHeader
+		hd, err := headerGets(data[offset : offset+lenHeader])
+		if err != nil {
+			return fmt.Errorf("header %d: %w", i, err)
+		}
+		if i != 0 && i != n && compareHeaders(headers[i-1], hd) >= 0 {
+			return fmt.Errorf("header %d: %s out of order", i, hd)
+		}
+		if i >= n && hd.AttachmentNumber != 0 {
+			return fmt.Errorf("retired header %d: %s is not a main document", i-n, hd)
+		}
+		headers[i] = hd
+	}
+	numbering := hf.numbering
+	*hf = NewHeaderFilter(headers[:n])
+	hf.numbering = numbering
+	if m > 0 {
+		hf.retired = headers[n:]
+	}
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. A Header
+// is represented by its document name i.e. "LHC-PM-QA-202.00". The zero
+// value Header is represented by an empty string.
+func (h Header) MarshalText() ([]byte, error) {
+	if h == (Header{}) {
+		return []byte{}, nil
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. It expects
+// a complete document name with attachment number i.e. "LHC-PM-QA-202.00".
+// An empty text yields the zero value Header.
+func (h *Header) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*h = Header{}
+		return nil
+	}
+	hd, err := ParseHeader(string(text), false)
+	if err != nil {
+		return err
+	}
+	*h = hd
+	return nil
+}
+
+// headerFields has the same fields as Header but none of its methods.
+// It is used to decode the legacy JSON object representation of a Header.
+type headerFields Header
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Besides the
+// JSON string representation it accepts the legacy object representation
+// of a Header, i.e. {"Number":202,"ProjectCode":[76,72,67],...}, so that
+// data stored prior to the introduction of text marshaling can still be read.
+func (h *Header) UnmarshalJSON(data []byte) error {
+	if !isJSONObject(data) {
+		return unmarshalJSONText(data, h)
+	}
+	var hd headerFields
+	if err := json.Unmarshal(data, &hd); err != nil {
+		return err
+	}
+	if Header(hd) != (Header{}) {
+		if err := Header(hd).Validate(); err != nil {
+			return err
+		}
+	}
+	*h = Header(hd)
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. A Revision is
+// represented by its string representation i.e. "B.2-draft", "AB" or "03-draft".
+// The zero value Revision is represented by an empty string.
+func (r Revision) MarshalText() ([]byte, error) {
+	if r == (Revision{}) {
+		return []byte{}, nil
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. It
+// expects text as returned by MarshalText for any of the revision kinds,
+// which is distinguished by the form of the text. An empty text yields the
+// zero value Revision.
+func (r *Revision) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*r = Revision{}
+		return nil
+	}
+	rev, err := detectRevisionKind(string(text)).Scheme().ParseRevision(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rev
+	return nil
+}
+
+// revisionFields has the same fields as Revision but none of its methods.
+// It is used to decode the legacy JSON object representation of a Revision.
+type revisionFields Revision
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Besides the
+// JSON string representation it accepts the legacy object representation
+// of a Revision, i.e. {"Index":[65,49],"IsRelease":false}.
+func (r *Revision) UnmarshalJSON(data []byte) error {
+	if !isJSONObject(data) {
+		return unmarshalJSONText(data, r)
+	}
+	var rev revisionFields
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return err
+	}
+	if Revision(rev) != (Revision{}) {
+		if err := Revision(rev).Validate(); err != nil {
+			return err
+		}
+	}
+	*r = Revision(rev)
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. A DocInfo is
+// represented by its full document name i.e. "LHC-PM-QA-202.00 rev B.2".
+// Creation and revision times are not part of the text representation.
+func (d DocInfo) MarshalText() ([]byte, error) {
+	if err := d.Header.Validate(); err != nil {
+		return nil, err
+	}
+	if err := d.Revision.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(d.Header.String() + _revStr + d.Revision.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. It
+// expects text as accepted by ParseDocumentName. Creation and revision
+// times of the result are zero.
+func (d *DocInfo) UnmarshalText(text []byte) error {
+	hd, rev, err := ParseDocumentName(string(text))
+	if err != nil {
+		return err
+	}
+	*d = DocInfo{Header: hd, Revision: rev}
+	return nil
+}
+
+// docInfoJSON is the JSON object representation of DocInfo.
+type docInfoJSON struct {
+	Header       Header
+	Revision     Revision
+	State        State `json:",omitempty"`
+	Creation     time.Time
+	RevisionTime time.Time
+}
+
+// legacyDocInfoJSON is the JSON object representation of DocInfo prior to
+// the introduction of text marshaling, where Header fields were embedded.
+type legacyDocInfoJSON struct {
+	headerFields
+	Revision     Revision
+	Creation     time.Time
+	RevisionTime time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface. Unlike the text
+// representation the JSON representation is an object which also
+// contains creation and revision times:
+//
+//	{"Header":"LHC-PM-QA-202.00","Revision":"B.2","State":"Released","Creation":"...","RevisionTime":"..."}
+//
+// The State member is omitted if the lifecycle state is not set.
+func (d DocInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(docInfoJSON{
+		Header:       d.Header,
+		Revision:     d.Revision,
+		State:        d.State,
+		Creation:     d.Creation,
+		RevisionTime: d.RevisionTime,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It accepts
+// the representation returned by MarshalJSON and the legacy representation
+// where header fields are members of the object.
+func (d *DocInfo) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if _, ok := fields["Header"]; ok {
+		var di docInfoJSON
+		if err := json.Unmarshal(data, &di); err != nil {
+			return err
+		}
+		*d = DocInfo{
+			Header:       di.Header,
+			Revision:     di.Revision,
+			State:        di.State,
+			Creation:     di.Creation,
+			RevisionTime: di.RevisionTime,
+		}
+		return nil
+	}
+	var legacy legacyDocInfoJSON
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	hd := Header(legacy.headerFields)
+	if hd != (Header{}) {
+		if err := hd.Validate(); err != nil {
+			return err
+		}
+	}
+	*d = DocInfo{
+		Header:       hd,
+		Revision:     legacy.Revision,
+		Creation:     legacy.Creation,
+		RevisionTime: legacy.RevisionTime,
+	}
+	return nil
+}
+
+func isJSONObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+// unmarshalJSONText decodes a JSON string into v using its
+// UnmarshalText method. A JSON null leaves v unmodified.
+func unmarshalJSONText(data []byte, v interface{ UnmarshalText([]byte) error }) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return v.UnmarshalText([]byte(s))
+}
+
+// puts writes the binary representation of the header to b. It does not
+// validate the header.
+func (h Header) puts(b []byte) error {
+	if len(b) < lenHeader {
+		return errors.New("puts arg too short")
+	}
+	b[0] = headerBinaryVersion
+	copy(b[1:], h.ProjectCode[:])
+	copy(b[1+capP:], h.EquipmentCode[:])
+	copy(b[1+capP+capE:], h.DocumentTypeCode[:])
+	binary.BigEndian.PutUint32(b[1+capP+capE+capDT:], uint32(h.Number))
+	b[lenHeader-1] = h.AttachmentNumber
+	return nil
+}
+
+// headerGets reads a header written by puts and validates it.
+func headerGets(b []byte) (Header, error) {
+	h := Header{}
+	if len(b) < lenHeader {
+		return h, errors.New("gets arg too short")
+	}
+	if b[0] != headerBinaryVersion {
+		return h, errBadBinaryVersion
+	}
+	copy(h.ProjectCode[:], b[1:1+capP])
+	copy(h.EquipmentCode[:], b[1+capP:1+capP+capE])
+	copy(h.DocumentTypeCode[:], b[1+capP+capE:1+capP+capE+capDT])
+	h.Number = int32(binary.BigEndian.Uint32(b[1+capP+capE+capDT:]))
+	h.AttachmentNumber = b[lenHeader-1]
+	if err := h.Validate(); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
+
+// puts writes the binary representation of the revision to b. It does not
+// validate the revision.
+func (r Revision) puts(b []byte) error {
+	if len(b) < lenRevision {
+		return errors.New("puts arg too short")
+	}
+	b[0] = revisionBinaryVersion
+	b[1] = byte(r.Kind)
+	b[2] = r.Index[0]
+	b[3] = r.Index[1]
+	b[4] = 0
+	if r.IsRelease {
+		b[4] |= revisionFlagRelease
+	}
+	return nil
+}
+
+// revisionGets reads a revision written by puts and validates it.
+func revisionGets(b []byte) (Revision, error) {
+	if len(b) < lenRevision {
+		return Revision{}, errors.New("gets arg too short")
+	}
+	if b[0] != revisionBinaryVersion {
+		return Revision{}, errBadBinaryVersion
+	}
+	if b[4]&^revisionFlagRelease != 0 {
+		return Revision{}, errors.New("unknown binary revision flags")
+	}
+	r := Revision{Kind: RevisionKind(b[1]), Index: [2]byte{b[2], b[3]}}
+	r.IsRelease = b[4]&revisionFlagRelease != 0
+	if err := r.Validate(); err != nil {
+		return Revision{}, err
+	}
+	return r, nil
+}
+
+// timeGets reads a length prefixed binary encoded time from b and returns
+// the remaining data.
+func timeGets(b []byte) (t time.Time, rest []byte, err error) {
+	if len(b) == 0 {
+		return t, nil, errors.New("missing time length")
+	}
+	n := int(b[0])
+	if len(b) < 1+n {
+		return t, nil, errors.New("binary time too short")
+	}
+	err = t.UnmarshalBinary(b[1 : 1+n])
+	return t, b[1+n:], err
+}
@@ -0,0 +1,278 @@
+package qap
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHeaderBinaryRoundTrip(t *testing.T) {
+	for _, test := range []string{
+		"SPS-PEC-HP-001.00",
+		"SPS-UPPE1-TP-001000.32",
+		"LHC-M-QA-999999.99",
+	} {
+		hd, err := ParseHeader(test, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := hd.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != lenHeader {
+			t.Errorf("expected binary length %d, got %d", lenHeader, len(b))
+		}
+		var got Header
+		err = got.UnmarshalBinary(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != hd {
+			t.Errorf("expected %q, got %q", hd, got)
+		}
+	}
+}
+
+func TestHeaderBinarySortable(t *testing.T) {
+	// Sorted in expected order.
+	names := []string{
+		"LHC-M-QA-002.00",
+		"LHC-M-QA-010.00",
+		"LHC-MA-DR-001.00",
+		"LHC-MA-DR-001.01",
+		"LHC-MA-QA-001.00",
+		"LHC-MB-AA-001.00",
+		"SPS-A-AA-001.00",
+	}
+	var keys [][]byte
+	for i := len(names) - 1; i >= 0; i-- {
+		hd, err := ParseHeader(names[i], false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := hd.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, b)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	for i, key := range keys {
+		var hd Header
+		err := hd.UnmarshalBinary(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hd.String() != names[i] {
+			t.Errorf("expected %dth sorted key to be %q, got %q", i, names[i], hd)
+		}
+	}
+}
+
+func TestDocInfoBinaryRoundTrip(t *testing.T) {
+	hd, rev, err := ParseDocumentName("LHC-PM-QA-202.00 rev B.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	info := DocInfo{
+		Header:       hd,
+		Revision:     rev,
+		State:        StateReleased,
+		Creation:     now.Add(-time.Hour),
+		RevisionTime: now,
+	}
+	b, err := info.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got DocInfo
+	err = got.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header != info.Header || got.Revision != info.Revision || got.State != info.State ||
+		!got.Creation.Equal(info.Creation) || !got.RevisionTime.Equal(info.RevisionTime) {
+		t.Errorf("expected %v, got %v", info, got)
+	}
+	if err := got.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Error("expected error unmarshalling truncated data")
+	}
+}
+
+func TestHeaderFilterBinaryRoundTrip(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(4)), 300)
+	hf := NewHeaderFilter(headers)
+	for _, hd := range headers[:10] {
+		hf.Remove(hd)
+	}
+	b, err := hf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired := len(hf.retired)
+	if retired == 0 {
+		t.Fatal("expected removed main documents to be retired")
+	}
+	if len(b) != lenFilterPrefix+(290+retired)*lenHeader {
+		t.Errorf("expected snapshot of 290 headers and %d retired headers, got %d bytes", retired, len(b))
+	}
+	var got HeaderFilter
+	got.SetNumberingPolicy("LHC", NumberingPolicy{Min: 1000})
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 290 || got.Tombstones() != 0 || len(got.retired) != retired {
+		t.Errorf("expected 290 headers without tombstones and %d retired, got %d, %d and %d", retired, got.Len(), got.Tombstones(), len(got.retired))
+	}
+	for i, hd := range headers {
+		if got.Has(hd) != (i >= 10) {
+			t.Errorf("expected Has(%s) == %t", hd, i >= 10)
+		}
+	}
+	if n, _ := got.NextNumber("LHC", "ZZ", "ZZ"); n != 1000 {
+		t.Errorf("numbering policy not kept, got number %d", n)
+	}
+	for _, bad := range [][]byte{b[:len(b)-1], b[:3], append([]byte{99}, b[1:]...)} {
+		if err := got.UnmarshalBinary(bad); err == nil {
+			t.Error("expected error unmarshalling malformed snapshot")
+		}
+	}
+	// Swap two headers so they are out of order.
+	swapped := append([]byte{}, b...)
+	first, second := swapped[lenFilterPrefix:lenFilterPrefix+lenHeader], swapped[lenFilterPrefix+lenHeader:lenFilterPrefix+2*lenHeader]
+	tmp := append([]byte{}, first...)
+	copy(first, second)
+	copy(second, tmp)
+	if err := got.UnmarshalBinary(swapped); err == nil {
+		t.Error("expected error unmarshalling unordered snapshot")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	hd, rev, err := ParseDocumentName("LHC-PM-QA-202.00 rev B.2-draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Round(0)
+	type record struct {
+		Header      Header
+		Revisions   []Revision
+		Attachments []Header
+		Info        DocInfo
+		Empty       Header
+	}
+	rec := record{
+		Header:      hd,
+		Revisions:   []Revision{NewRevision(), rev},
+		Attachments: []Header{hd},
+		Info:        DocInfo{Header: hd, Revision: rev, Creation: now, RevisionTime: now},
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `{"Header":"LHC-PM-QA-202.00","Revisions":["A.1-draft","B.2-draft"],"Attachments":["LHC-PM-QA-202.00"],`
+	if !bytes.HasPrefix(b, []byte(expect)) {
+		t.Errorf("expected JSON prefix %s, got %s", expect, b)
+	}
+	var got record
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header != rec.Header || got.Revisions[1] != rev || got.Attachments[0] != hd ||
+		got.Info.Header != hd || got.Info.Revision != rev || !got.Info.Creation.Equal(now) || got.Empty != (Header{}) {
+		t.Errorf("expected %v, got %v", rec, got)
+	}
+	text, err := rec.Info.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "LHC-PM-QA-202.00 rev B.2-draft" {
+		t.Errorf("unexpected DocInfo text %q", text)
+	}
+}
+
+func TestUnmarshalLegacyJSON(t *testing.T) {
+	const legacy = `{
+		"Revision": {"Index":[66,50],"IsRelease":true},
+		"Attachment": {"Number":202,"ProjectCode":[76,72,67],"EquipmentCode":[80,77,0,0,0],"DocumentTypeCode":[81,65],"AttachmentNumber":1},
+		"Info": {"Number":202,"ProjectCode":[76,72,67],"EquipmentCode":[80,77,0,0,0],"DocumentTypeCode":[81,65],"AttachmentNumber":0,
+			"Revision":{"Index":[65,49],"IsRelease":false},"Creation":"2022-06-01T00:00:00Z","RevisionTime":"2022-06-01T00:00:00Z"}
+	}`
+	var got struct {
+		Revision   Revision
+		Attachment Header
+		Info       DocInfo
+	}
+	err := json.Unmarshal([]byte(legacy), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Revision.String() != "B.2" {
+		t.Errorf("expected revision B.2, got %s", got.Revision)
+	}
+	if got.Attachment.String() != "LHC-PM-QA-202.01" {
+		t.Errorf("expected attachment LHC-PM-QA-202.01, got %s", got.Attachment)
+	}
+	if got.Info.String() != "LHC-PM-QA-202.00 rev A.1-draft" {
+		t.Errorf("expected info LHC-PM-QA-202.00 rev A.1-draft, got %s", got.Info)
+	}
+	var bad Revision
+	if err := json.Unmarshal([]byte(`{"Index":[0,50]}`), &bad); err == nil {
+		t.Error("expected error decoding invalid legacy revision")
+	}
+}
+
+func FuzzHeaderBinary(f *testing.F) {
+	f.Add("SPS-PEC-HP-1.99")
+	f.Add("ZZZ-PEC2C-HP-001.55")
+	f.Add("LHC-SIRP-HP-21001.00")
+	f.Fuzz(func(t *testing.T, a string) {
+		hd, err := ParseHeader(a, false)
+		if err != nil {
+			return
+		}
+		b, err := hd.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshalling valid header %q: %s", hd, err)
+		}
+		var got Header
+		err = got.UnmarshalBinary(b)
+		if err != nil {
+			t.Fatalf("unmarshalling %q: %s", hd, err)
+		}
+		if got != hd {
+			t.Fatalf("binary round trip %q != %q", got, hd)
+		}
+	})
+}
+
+func FuzzUnmarshalHeaderBinary(f *testing.F) {
+	f.Add([]byte("\x01LHC\x00MVR\x00\x00QA\x00\x00\x00\x00\xca\x00"))
+	f.Add([]byte("\x01SPS\x00UPPE1TP\x00\x00\x00\x03\xe8\x20"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var hd Header
+		err := hd.UnmarshalBinary(b)
+		if err != nil {
+			return
+		}
+		got, err := hd.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshalling unmarshalled header %q: %s", hd, err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Fatalf("binary round trip %q != %q", got, b)
+		}
+		var hd2 Header
+		err = hd2.UnmarshalBinary(got)
+		if err != nil || hd2 != hd {
+			t.Fatalf("binary round trip %q != %q: %v", hd2, hd, err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package qap
+
+import "sort"
+
+// FacetCount is the amount of headers sharing a code.
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// Facets holds aggregate counts of headers. Counts are ordered by value.
+type Facets struct {
+	// Total is the amount of headers counted.
+	Total int
+	// Main is the amount of main documents, Attachments the amount of attachments.
+	Main, Attachments int
+	Projects          []FacetCount
+	// Systems counts headers by the first letter of their equipment code.
+	Systems []FacetCount
+	// Equipment counts headers by equipment code prefix.
+	Equipment     []FacetCount
+	DocumentTypes []FacetCount
+}
+
+// Facets counts headers matching q by project, equipment system letter, equipment
+// code prefix of length equipmentPrefix and document type in a single pass. If
+// equipmentPrefix is not in range 1..5 headers are counted by their full equipment code.
+// The zero value Query counts all headers in the filter.
+func (hf *HeaderFilter) Facets(q Query, equipmentPrefix int) Facets {
+	if equipmentPrefix < 1 || equipmentPrefix > capE {
+		equipmentPrefix = capE
+	}
+	var f Facets
+	projects := make(map[[capP]byte]int)
+	systems := make(map[byte]int)
+	equipment := make(map[[capE]byte]int)
+	doctypes := make(map[[capDT]byte]int)
+	lo, hi := hf.prefixRange(q.prefix())
+	for _, i := range hf.sorted[lo:hi] {
+		hd := &hf.data[i]
+		if hf.deleted[i] || !q.Match(*hd) {
+			continue
+		}
+		f.Total++
+		if hd.AttachmentNumber == 0 {
+			f.Main++
+		} else {
+			f.Attachments++
+		}
+		var eq [capE]byte
+		copy(eq[:equipmentPrefix], hd.EquipmentCode[:])
+		projects[hd.ProjectCode]++
+		systems[hd.EquipmentCode[0]]++
+		equipment[eq]++
+		doctypes[hd.DocumentTypeCode]++
+	}
+	for code, n := range projects {
+		f.Projects = append(f.Projects, FacetCount{Value: validQAPAlphanum(code[:]), Count: n})
+	}
+	for code, n := range systems {
+		f.Systems = append(f.Systems, FacetCount{Value: string(code), Count: n})
+	}
+	for code, n := range equipment {
+		f.Equipment = append(f.Equipment, FacetCount{Value: validQAPAlphanum(code[:]), Count: n})
+	}
+	for code, n := range doctypes {
+		f.DocumentTypes = append(f.DocumentTypes, FacetCount{Value: validQAPAlphanum(code[:]), Count: n})
+	}
+	for _, counts := range [][]FacetCount{f.Projects, f.Systems, f.Equipment, f.DocumentTypes} {
+		sort.Slice(counts, func(i, j int) bool { return counts[i].Value < counts[j].Value })
+	}
+	return f
+}
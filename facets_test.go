@@ -0,0 +1,67 @@
+package qap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFacets(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(3)), 500)
+	hf := NewHeaderFilter(headers)
+	hf.Remove(headers[0])
+	for _, query := range []string{"", "LHC", "SPS-M*", "DT:QA .>0", "!P:LHC"} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := hf.Facets(q, 2)
+		var expect Facets
+		projects := make(map[string]int)
+		systems := make(map[string]int)
+		equipment := make(map[string]int)
+		doctypes := make(map[string]int)
+		for _, hd := range headers[1:] {
+			if !q.Match(hd) {
+				continue
+			}
+			expect.Total++
+			if hd.AttachmentNumber == 0 {
+				expect.Main++
+			} else {
+				expect.Attachments++
+			}
+			eq := hd.Equipment()
+			projects[hd.Project()]++
+			systems[eq[:1]]++
+			equipment[eq[:minInt(2, len(eq))]]++
+			doctypes[hd.DocumentType()]++
+		}
+		if f.Total != expect.Total || f.Main != expect.Main || f.Attachments != expect.Attachments {
+			t.Errorf("query %q: expected total=%d main=%d attachments=%d, got %d, %d, %d", query,
+				expect.Total, expect.Main, expect.Attachments, f.Total, f.Main, f.Attachments)
+		}
+		for _, facet := range []struct {
+			name   string
+			got    []FacetCount
+			expect map[string]int
+		}{
+			{"projects", f.Projects, projects},
+			{"systems", f.Systems, systems},
+			{"equipment", f.Equipment, equipment},
+			{"document types", f.DocumentTypes, doctypes},
+		} {
+			if len(facet.got) != len(facet.expect) {
+				t.Errorf("query %q: expected %d %s, got %v", query, len(facet.expect), facet.name, facet.got)
+				continue
+			}
+			for i, c := range facet.got {
+				if facet.expect[c.Value] != c.Count {
+					t.Errorf("query %q: %s %q expected count %d, got %d", query, facet.name, c.Value, facet.expect[c.Value], c.Count)
+				}
+				if i > 0 && facet.got[i-1].Value >= c.Value {
+					t.Errorf("query %q: %s not ordered", query, facet.name)
+				}
+			}
+		}
+	}
+}
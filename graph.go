@@ -0,0 +1,163 @@
+package qap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DocumentCounts returns the amount of headers of the project in headers
+// under each node of the equipment structure keyed by equipment code. The
+// count of a node includes the headers of its children, i.e. the count of
+// "MV" includes headers with equipment code "MVR". Attachments are counted.
+func (p Project) DocumentCounts(headers Querier) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := p.doHeaders(headers, func(hd Header) {
+		eq := hd.Equipment()
+		for i := 1; i <= len(eq); i++ {
+			counts[eq[:i]]++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// DocumentHeaders returns the headers of the project in headers keyed by the
+// code of the deepest node of the equipment structure their equipment code
+// starts with, i.e. headers of serial "MVR01" are keyed by type "MVR".
+// Headers are ordered as returned by Query and those with equipment codes
+// outside of the structure are omitted.
+func (p Project) DocumentHeaders(headers Querier) (map[string][]Header, error) {
+	byNode := make(map[string][]Header)
+	err := p.doHeaders(headers, func(hd Header) {
+		eq := hd.Equipment()
+		for i := len(eq); i > 0; i-- {
+			if _, err := p.node(eq[:i]); err == nil {
+				byNode[eq[:i]] = append(byNode[eq[:i]], hd)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return byNode, nil
+}
+
+// doHeaders calls f for every header of the project in headers.
+func (p Project) doHeaders(headers Querier, f func(Header)) error {
+	q, err := ParseQuery("P:" + p.Project())
+	if err != nil {
+		return err
+	}
+	it := headers.Query(q)
+	buf := make([]Header, 64)
+	for {
+		n, cursor := it.Next(buf)
+		for _, hd := range buf[:n] {
+			f(hd)
+		}
+		if cursor.IsZero() {
+			return nil
+		}
+	}
+}
+
+// GraphOptions are the annotations of project structure graphs.
+type GraphOptions struct {
+	// Counts annotates nodes with their document count if not nil. See DocumentCounts.
+	Counts map[string]int
+	// Headers are drawn as leaves of the node they are keyed by if not nil. See DocumentHeaders.
+	Headers map[string][]Header
+}
+
+// WriteDOT writes the project structure as a Graphviz DOT directed graph to w
+// with an edge from every node to each of its children.
+func (p Project) WriteDOT(w io.Writer, opts GraphOptions) error {
+	bw := bufio.NewWriter(w)
+	project := p.Project()
+	fmt.Fprintf(bw, "digraph %s {\n\trankdir=LR;\n\tnode [shape=box];\n", dotQuote(project))
+	fmt.Fprintf(bw, "\t%s [label=%s];\n", dotQuote(project), dotQuote(project+"\n"+p.Name))
+	p.Walk(func(n Node) error {
+		id := dotQuote(project + "-" + n.Code)
+		fmt.Fprintf(bw, "\t%s [label=%s];\n", id, dotQuote(n.Code+"\n"+graphLabel(n, opts.Counts)))
+		fmt.Fprintf(bw, "\t%s -> %s;\n", dotQuote(graphParent(project, n)), id)
+		for _, hd := range opts.Headers[n.Code] {
+			fmt.Fprintf(bw, "\t%s [shape=note];\n\t%s -> %s;\n", dotQuote(hd.String()), id, dotQuote(hd.String()))
+		}
+		return nil
+	})
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// WriteMermaid writes the project structure as a Mermaid flowchart to w.
+func (p Project) WriteMermaid(w io.Writer, opts GraphOptions) error {
+	bw := bufio.NewWriter(w)
+	project := p.Project()
+	fmt.Fprintf(bw, "flowchart LR\n\t%s[%s]\n", project, mermaidQuote(project+" "+p.Name))
+	p.Walk(func(n Node) error {
+		id := project + "_" + n.Code
+		parent := strings.Replace(graphParent(project, n), "-", "_", 1)
+		fmt.Fprintf(bw, "\t%s --> %s[%s]\n", parent, id, mermaidQuote(n.Code+" "+graphLabel(n, opts.Counts)))
+		for _, hd := range opts.Headers[n.Code] {
+			fmt.Fprintf(bw, "\t%s --> %s([%s])\n", id, mermaidHeaderID.Replace(hd.String()), mermaidQuote(hd.String()))
+		}
+		return nil
+	})
+	return bw.Flush()
+}
+
+// WriteTree writes the project structure as a plain text tree to w with
+// children indented under their parent.
+//
+//	LHC Large Hadron Collider
+//	  M Engines (3)
+//	    MV Vacuum (3)
+//	      LHC-MV-DR-001.00
+func (p Project) WriteTree(w io.Writer, opts GraphOptions) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s\n", p.Project(), p.Name)
+	p.Walk(func(n Node) error {
+		indent := strings.Repeat("  ", int(n.Level))
+		fmt.Fprintf(bw, "%s%s %s\n", indent, n.Code, graphLabel(n, opts.Counts))
+		for _, hd := range opts.Headers[n.Code] {
+			fmt.Fprintf(bw, "%s  %s\n", indent, hd)
+		}
+		return nil
+	})
+	return bw.Flush()
+}
+
+// graphLabel returns the name of the node followed by its document count if counts is not nil.
+func graphLabel(n Node, counts map[string]int) string {
+	if counts == nil {
+		return n.Name
+	}
+	return fmt.Sprintf("%s (%d)", n.Name, counts[n.Code])
+}
+
+// graphParent returns the graph identifier of the parent of n, which
+// is the project for systems.
+func graphParent(project string, n Node) string {
+	if n.Level == LevelSystem {
+		return project
+	}
+	return project + "-" + n.Code[:len(n.Code)-1]
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// mermaidHeaderID replaces the characters of a document name
+// not allowed in Mermaid node identifiers.
+var mermaidHeaderID = strings.NewReplacer("-", "_", ".", "_")
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,114 @@
+package qap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProjectGraphs(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}, Name: "Large Hadron Collider"}
+	for _, code := range []string{"M", "MV", "MVR", "X"} {
+		if err := p.AddEquipmentCode(code, `name "`+code+`"`, "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var headers []Header
+	for _, name := range []string{"LHC-MVR-QA-001.00", "LHC-MVR-QA-001.01", "LHC-MV-DR-002.00", "SPS-MVR-QA-001.00"} {
+		hd, err := ParseHeader(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, hd)
+	}
+	hf := NewHeaderFilter(headers)
+	counts, err := p.DocumentCounts(&hf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["M"] != 3 || counts["MV"] != 3 || counts["MVR"] != 2 || counts["X"] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+
+	var tree strings.Builder
+	if err := p.WriteTree(&tree, GraphOptions{Counts: counts}); err != nil {
+		t.Fatal(err)
+	}
+	const wantTree = `LHC Large Hadron Collider
+  M name "M" (3)
+    MV name "MV" (3)
+      MVR name "MVR" (2)
+  X name "X" (0)
+`
+	if tree.String() != wantTree {
+		t.Errorf("got tree\n%s\nwant\n%s", tree.String(), wantTree)
+	}
+
+	var dot strings.Builder
+	if err := p.WriteDOT(&dot, GraphOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`digraph "LHC" {`,
+		`"LHC-MVR" [label="MVR\nname \"MVR\""];`,
+		`"LHC-MV" -> "LHC-MVR";`,
+		`"LHC" -> "LHC-X";`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("DOT output missing %q:\n%s", want, dot.String())
+		}
+	}
+
+	var mermaid strings.Builder
+	if err := p.WriteMermaid(&mermaid, GraphOptions{Counts: counts}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"flowchart LR\n",
+		`LHC_MV --> LHC_MVR["MVR name #quot;MVR#quot; (2)"]`,
+		`LHC --> LHC_M["M name #quot;M#quot; (3)"]`,
+	} {
+		if !strings.Contains(mermaid.String(), want) {
+			t.Errorf("Mermaid output missing %q:\n%s", want, mermaid.String())
+		}
+	}
+
+	// Headers are drawn under the node of their equipment code.
+	byNode, err := p.DocumentHeaders(&hf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byNode) != 2 || len(byNode["MVR"]) != 2 || len(byNode["MV"]) != 1 {
+		t.Errorf("unexpected headers by node %v", byNode)
+	}
+	opts := GraphOptions{Headers: byNode}
+	tree.Reset()
+	if err := p.WriteTree(&tree, opts); err != nil {
+		t.Fatal(err)
+	}
+	const wantHeadersTree = `LHC Large Hadron Collider
+  M name "M"
+    MV name "MV"
+      LHC-MV-DR-002.00
+      MVR name "MVR"
+        LHC-MVR-QA-001.00
+        LHC-MVR-QA-001.01
+  X name "X"
+`
+	if tree.String() != wantHeadersTree {
+		t.Errorf("got tree\n%s\nwant\n%s", tree.String(), wantHeadersTree)
+	}
+	dot.Reset()
+	if err := p.WriteDOT(&dot, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"LHC-MVR" -> "LHC-MVR-QA-001.01";`; !strings.Contains(dot.String(), want) {
+		t.Errorf("DOT output missing %q:\n%s", want, dot.String())
+	}
+	mermaid.Reset()
+	if err := p.WriteMermaid(&mermaid, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := `LHC_MV --> LHC_MV_DR_002_00(["LHC-MV-DR-002.00"])`; !strings.Contains(mermaid.String(), want) {
+		t.Errorf("Mermaid output missing %q:\n%s", want, mermaid.String())
+	}
+}
@@ -37,9 +37,9 @@ func TestParseDocumentName(t *testing.T) {
 		{
 			Input: "SPS-PEC-HP-001.00",
 			Expect: Header{
-				ProjectCode:      [3]byte{'S', 'P', 'S'},
+				ProjectCode:      [4]byte{'S', 'P', 'S'},
 				EquipmentCode:    [5]byte{'P', 'E', 'C'},
-				DocumentTypeCode: [2]byte{'H', 'P'},
+				DocumentTypeCode: [3]byte{'H', 'P'},
 				Number:           1,
 				AttachmentNumber: 0,
 			},
@@ -47,9 +47,9 @@ func TestParseDocumentName(t *testing.T) {
 		{
 			Input: "SPS-UPPE1-TP-001000.32",
 			Expect: Header{
-				ProjectCode:      [3]byte{'S', 'P', 'S'},
+				ProjectCode:      [4]byte{'S', 'P', 'S'},
 				EquipmentCode:    [5]byte{'U', 'P', 'P', 'E', '1'},
-				DocumentTypeCode: [2]byte{'T', 'P'},
+				DocumentTypeCode: [3]byte{'T', 'P'},
 				Number:           1000,
 				AttachmentNumber: 32,
 			},
@@ -1,23 +1,43 @@
 package qap
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"sort"
 )
 
 // HeaderFilter is an in-memory header filtering
 // structure optimized for common search patterns.
 type HeaderFilter struct {
-	data   []Header
-	number []int32
-	// Projects are indexed by it's full name.
-	projects [][lenP]byte
-	// Equipment is indexed by individual characters.
-	equipment [lenE][]byte
-	// document type is indexed by individual characters.
-	document   [lenDT][]byte
-	attachment []uint8
+	data []Header
 	// deleted indicates if header at ith place has been removed from filter.
 	deleted []bool
+	// removed is the amount of headers marked as deleted.
+	removed int
+	// index maps headers to their position in data for exact lookups.
+	index map[Header]int
+	// sorted holds positions in data ordered by project, equipment,
+	// document type, number and attachment number for prefix lookups.
+	sorted []int
+	// codes counts headers by their project, equipment and document type codes.
+	codes map[codesKey]int
+	// numbering holds the numbering policies of projects. See SetNumberingPolicy.
+	numbering map[[capP]byte]NumberingPolicy
+	// retired holds the sorted main document headers whose numbers
+	// must not be allocated again. See Retire.
+	retired []Header
+}
+
+// codesKey is the concatenation of a header's zero padded project,
+// equipment and document type codes.
+type codesKey [capP + capE + capDT]byte
+
+func headerCodes(h *Header) (key codesKey) {
+	copy(key[:], h.ProjectCode[:])
+	copy(key[capP:], h.EquipmentCode[:])
+	copy(key[capP+capE:], h.DocumentTypeCode[:])
+	return key
 }
 
 // NewHeaderFilter initializes a HeaderFilter with headers data.
@@ -27,35 +47,39 @@ func NewHeaderFilter(headers []Header) HeaderFilter {
 		return HeaderFilter{}
 	}
 	hf := HeaderFilter{
-		data:       make([]Header, n),
-		projects:   make([][lenP]byte, n),
-		attachment: make([]uint8, n),
-		number:     make([]int32, n),
-		deleted:    make([]bool, n),
-	}
-	for i := 0; i < lenE; i++ {
-		hf.equipment[i] = make([]byte, n)
-	}
-	for i := 0; i < lenDT; i++ {
-		hf.document[i] = make([]byte, n)
+		data:    make([]Header, n),
+		deleted: make([]bool, n),
+		index:   make(map[Header]int, n),
+		sorted:  make([]int, n),
+		codes:   make(map[codesKey]int),
 	}
 	copy(hf.data, headers)
 	for i, hd := range headers {
-		hf.number[i] = hd.Number
-		hf.projects[i] = hd.ProjectCode
-		hf.attachment[i] = hd.AttachmentNumber
-		for j := 0; j < lenE; j++ {
-			hf.equipment[j][i] = hd.EquipmentCode[j]
-		}
-		for j := 0; j < lenDT; j++ {
-			hf.document[j][i] = hd.DocumentTypeCode[j]
-		}
+		hf.index[hd] = i
+		hf.codes[headerCodes(&hd)]++
+		hf.sorted[i] = i
 	}
+	hf.sortIndices(hf.sorted)
 	return hf
 }
 
+// sortIndices sorts positions in data by their headers' order. Already
+// sorted positions, such as those of a snapshot, are not sorted again.
+func (hf *HeaderFilter) sortIndices(idx []int) {
+	less := func(i, j int) bool {
+		return compareHeaders(hf.data[idx[i]], hf.data[idx[j]]) < 0
+	}
+	if !sort.SliceIsSorted(idx, less) {
+		sort.SliceStable(idx, less)
+	}
+}
+
 // Len returns the amount of headers contained in filter.
-func (hf *HeaderFilter) Len() int { return len(hf.data) }
+func (hf *HeaderFilter) Len() int { return len(hf.data) - hf.removed }
+
+// Tombstones returns the amount of removed headers still taking up space
+// in the filter. See Compact.
+func (hf *HeaderFilter) Tombstones() int { return hf.removed }
 
 // AddHeader adds a header to the filter.
 func (hf *HeaderFilter) AddHeader(h Header) error {
@@ -65,22 +89,154 @@ func (hf *HeaderFilter) AddHeader(h Header) error {
 	if hf.Has(h) {
 		return errors.New("header already present")
 	}
+	if hf.index == nil {
+		hf.index = make(map[Header]int)
+		hf.codes = make(map[codesKey]int)
+	}
+	idx := len(hf.data)
+	hf.index[h] = idx
+	hf.codes[headerCodes(&h)]++
+	pos := sort.Search(len(hf.sorted), func(i int) bool {
+		return compareHeaders(hf.data[hf.sorted[i]], h) > 0
+	})
+	hf.sorted = append(hf.sorted, 0)
+	copy(hf.sorted[pos+1:], hf.sorted[pos:])
+	hf.sorted[pos] = idx
 	hf.data = append(hf.data, h)
-	hf.number = append(hf.number, h.Number)
-	hf.projects = append(hf.projects, h.ProjectCode)
-	hf.attachment = append(hf.attachment, h.AttachmentNumber)
 	hf.deleted = append(hf.deleted, false)
-	for j := 0; j < lenE; j++ {
-		hf.equipment[j] = append(hf.equipment[j], h.EquipmentCode[j])
+	return nil
+}
+
+// AddHeaders adds headers to the filter in a single batch, which is faster
+// than adding headers one by one with AddHeader when loading many headers.
+// No header is added if any header is invalid or already present.
+func (hf *HeaderFilter) AddHeaders(headers []Header) error {
+	batch := make(map[Header]bool, len(headers))
+	for _, h := range headers {
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("header %s: %w", h, err)
+		}
+		if hf.Has(h) || batch[h] {
+			return fmt.Errorf("header %s already present", h)
+		}
+		batch[h] = true
 	}
-	for j := 0; j < lenDT; j++ {
-		hf.document[j] = append(hf.document[j], h.DocumentTypeCode[j])
+	if hf.index == nil {
+		hf.index = make(map[Header]int, len(headers))
+		hf.codes = make(map[codesKey]int)
 	}
+	added := make([]int, len(headers))
+	for i, h := range headers {
+		idx := len(hf.data)
+		hf.index[h] = idx
+		hf.codes[headerCodes(&h)]++
+		hf.data = append(hf.data, h)
+		hf.deleted = append(hf.deleted, false)
+		added[i] = idx
+	}
+	hf.sortIndices(added)
+	// Merge the sorted positions of the added headers with those already present.
+	merged := make([]int, 0, len(hf.sorted)+len(added))
+	i, j := 0, 0
+	for i < len(hf.sorted) && j < len(added) {
+		if compareHeaders(hf.data[added[j]], hf.data[hf.sorted[i]]) < 0 {
+			merged = append(merged, added[j])
+			j++
+		} else {
+			merged = append(merged, hf.sorted[i])
+			i++
+		}
+	}
+	merged = append(merged, hf.sorted[i:]...)
+	hf.sorted = append(merged, added[j:]...)
 	return nil
 }
 
+// Remove removes the header h from the filter. The header's space in
+// the filter is not reclaimed until Compact is called.
+func (hf *HeaderFilter) Remove(h Header) error {
+	if !hf.Has(h) {
+		return errors.New("header not present")
+	}
+	hf.deleted[hf.index[h]] = true
+	delete(hf.index, h)
+	key := headerCodes(&h)
+	if hf.codes[key]--; hf.codes[key] <= 0 {
+		delete(hf.codes, key)
+	}
+	hf.removed++
+	if h.AttachmentNumber == 0 {
+		hf.retire(h)
+	}
+	return nil
+}
+
+// Retire marks the number of the main document header h as used so that
+// NextNumber never allocates it again, i.e. for documents that were deleted
+// before the filter was built. Remove retires the numbers of main documents.
+func (hf *HeaderFilter) Retire(h Header) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	if h.AttachmentNumber != 0 {
+		return errors.New("only main document numbers can be retired")
+	}
+	hf.retire(h)
+	return nil
+}
+
+func (hf *HeaderFilter) retire(h Header) {
+	pos := sort.Search(len(hf.retired), func(i int) bool {
+		return compareHeaders(hf.retired[i], h) >= 0
+	})
+	if pos < len(hf.retired) && hf.retired[pos] == h {
+		return
+	}
+	hf.retired = append(hf.retired, Header{})
+	copy(hf.retired[pos+1:], hf.retired[pos:])
+	hf.retired[pos] = h
+}
+
+// Replace replaces the header old with new, i.e. when renaming a document.
+// The filter is left unmodified if old is not present or new is already present.
+func (hf *HeaderFilter) Replace(old, new Header) error {
+	if err := new.Validate(); err != nil {
+		return err
+	}
+	if !hf.Has(old) {
+		return errors.New("header to replace not present")
+	}
+	if old == new {
+		return nil
+	}
+	if hf.Has(new) {
+		return errors.New("header already present")
+	}
+	hf.Remove(old)
+	return hf.AddHeader(new)
+}
+
+// Compact reclaims the space taken up by removed headers. Indices of headers
+// passed to the Do and DoCodes callbacks may change after calling Compact.
+func (hf *HeaderFilter) Compact() {
+	if hf.removed == 0 {
+		return
+	}
+	live := make([]Header, 0, hf.Len())
+	for i, hd := range hf.data {
+		if !hf.deleted[i] {
+			live = append(live, hd)
+		}
+	}
+	numbering, retired := hf.numbering, hf.retired
+	*hf = NewHeaderFilter(live)
+	hf.numbering, hf.retired = numbering, retired
+}
+
 // HumanQuery queries filter for n matches which are stored in dst. The total
-// amount of matches found is totalFound.
+// amount of matches found is totalFound. Matches are ordered by project,
+// equipment, document type, number and attachment number. Queries with a
+// project code only visit headers of that project and equipment prefix.
 func (hf *HeaderFilter) HumanQuery(dst []Header, query string, page int) (n, totalFound int) {
 	if page < 0 {
 		panic("page must be 0 or greater")
@@ -93,7 +249,6 @@ func (hf *HeaderFilter) HumanQuery(dst []Header, query string, page int) (n, tot
 		}
 		return 0, 1
 	}
-	dataLen := hf.Len()
 	proj, equip, docT := ParseDocumentCodes(query)
 	matchProj := len(proj) == lenP
 	matchEquip := equip != ""
@@ -102,24 +257,35 @@ func (hf *HeaderFilter) HumanQuery(dst []Header, query string, page int) (n, tot
 	if active == 0 {
 		return 0, 0
 	}
+	var projCode [capP]byte
+	var docTCode [capDT]byte
+	copy(projCode[:], proj)
+	copy(docTCode[:], docT)
+	var prefix []byte
+	if matchProj {
+		prefix = append(prefix, proj...)
+		prefix = append(prefix, make([]byte, capP-len(proj))...)
+		if matchEquip && len(equip) <= capE {
+			prefix = append(prefix, equip...)
+		}
+	}
+	lo, hi := hf.prefixRange(prefix)
 	found := 0
 	added := 0
-	for i := 0; i < dataLen; i++ {
+	for _, i := range hf.sorted[lo:hi] {
 		matches := 0
 		searching := len(dst) != 0 && (found/len(dst) == page)
 		if hf.deleted[i] {
 			continue
 		}
-		if matchProj && hf.data[i].Project() == proj {
+		hd := &hf.data[i]
+		if matchProj && hd.ProjectCode == projCode {
 			matches++
 		}
-		if matchEquip {
-			eq := hf.data[i].Equipment()
-			if len(eq) >= len(equip) && eq[:len(equip)] == equip {
-				matches++
-			}
+		if matchEquip && bytes.HasPrefix(hd.EquipmentCode[:], []byte(equip)) {
+			matches++
 		}
-		if matchdocT && hf.data[i].DocumentType() == docT {
+		if matchdocT && hd.DocumentTypeCode == docTCode {
 			matches++
 		}
 		if matches >= active {
@@ -133,6 +299,28 @@ func (hf *HeaderFilter) HumanQuery(dst []Header, query string, page int) (n, tot
 	return added, found
 }
 
+// Search queries filter for headers matching q. The page'th group of
+// len(dst) matches is stored in dst and the total amount of matches found
+// is totalFound. Matches are ordered by project, equipment, document type,
+// number and attachment number.
+func (hf *HeaderFilter) Search(dst []Header, q Query, page int) (n, totalFound int) {
+	if page < 0 {
+		panic("page must be 0 or greater")
+	}
+	lo, hi := hf.prefixRange(q.prefix())
+	for _, i := range hf.sorted[lo:hi] {
+		if hf.deleted[i] || !q.Match(hf.data[i]) {
+			continue
+		}
+		if len(dst) != 0 && totalFound/len(dst) == page {
+			dst[n] = hf.data[i]
+			n++
+		}
+		totalFound++
+	}
+	return n, totalFound
+}
+
 func b2i(b bool) int {
 	if b {
 		return 1
@@ -147,22 +335,36 @@ func min(a, b int) int {
 	return b
 }
 
+// Has reports whether the filter contains the header h.
 func (hf *HeaderFilter) Has(h Header) bool {
-	n := hf.Len()
 	if err := h.Validate(); err != nil {
 		return false
 	}
-	for i := 0; i < n; i++ {
-		if !hf.deleted[i] && HeadersEqual(hf.data[i], h) {
-			return true
+	i, ok := hf.index[h]
+	return ok && !hf.deleted[i]
+}
+
+// Do calls f for every header in the filter in the order they were added.
+// If f returns an error iteration is stopped and the error returned.
+func (hf *HeaderFilter) Do(f func(i int, h Header) error) error {
+	for i := 0; i < len(hf.data); i++ {
+		if !hf.deleted[i] {
+			err := f(i, hf.data[i])
+			if err != nil {
+				return err
+			}
 		}
 	}
-	return false
+	return nil
 }
 
-func (hf *HeaderFilter) Do(f func(i int, h Header) error) error {
-	n := hf.Len()
-	for i := 0; i < n; i++ {
+// DoCodes calls f for every header in the filter with the same project,
+// equipment and document type codes as h in ascending number and attachment
+// number order. If f returns an error iteration is stopped and the error returned.
+func (hf *HeaderFilter) DoCodes(h Header, f func(i int, h Header) error) error {
+	key := headerCodes(&h)
+	lo, hi := hf.prefixRange(key[:])
+	for _, i := range hf.sorted[lo:hi] {
 		if !hf.deleted[i] {
 			err := f(i, hf.data[i])
 			if err != nil {
@@ -172,3 +374,55 @@ func (hf *HeaderFilter) Do(f func(i int, h Header) error) error {
 	}
 	return nil
 }
+
+// prefixRange returns the range of hf.sorted whose headers' concatenated
+// project, equipment and document type codes start with prefix.
+func (hf *HeaderFilter) prefixRange(prefix []byte) (lo, hi int) {
+	if len(prefix) == 0 {
+		return 0, len(hf.sorted)
+	}
+	cmp := func(i int) int {
+		codes := headerCodes(&hf.data[hf.sorted[i]])
+		return bytes.Compare(codes[:len(prefix)], prefix)
+	}
+	lo = sort.Search(len(hf.sorted), func(i int) bool { return cmp(i) >= 0 })
+	hi = lo + sort.Search(len(hf.sorted)-lo, func(i int) bool { return cmp(lo+i) > 0 })
+	return lo, hi
+}
+
+// retiredRange returns the range of hf.retired whose headers' concatenated
+// project, equipment and document type codes start with prefix.
+func (hf *HeaderFilter) retiredRange(prefix []byte) (lo, hi int) {
+	cmp := func(i int) int {
+		codes := headerCodes(&hf.retired[i])
+		return bytes.Compare(codes[:len(prefix)], prefix)
+	}
+	lo = sort.Search(len(hf.retired), func(i int) bool { return cmp(i) >= 0 })
+	hi = lo + sort.Search(len(hf.retired)-lo, func(i int) bool { return cmp(lo+i) > 0 })
+	return lo, hi
+}
+
+// compareHeaders compares headers by project, equipment, document type,
+// number and attachment number in that order, which is the same order as
+// their binary representation.
+func compareHeaders(a, b Header) int {
+	if c := bytes.Compare(a.ProjectCode[:], b.ProjectCode[:]); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(a.EquipmentCode[:], b.EquipmentCode[:]); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(a.DocumentTypeCode[:], b.DocumentTypeCode[:]); c != 0 {
+		return c
+	}
+	switch {
+	case a.Number != b.Number:
+		if a.Number < b.Number {
+			return -1
+		}
+		return 1
+	case a.AttachmentNumber != b.AttachmentNumber:
+		return cmpByte(a.AttachmentNumber, b.AttachmentNumber)
+	}
+	return 0
+}
@@ -0,0 +1,322 @@
+package qap
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestHeaderFilterQuery(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(1)), 2000)
+	hf := NewHeaderFilter(headers[:1000])
+	for _, hd := range headers[1000:] {
+		if err := hf.AddHeader(hd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, hd := range headers {
+		if !hf.Has(hd) {
+			t.Fatalf("expected filter to contain %s", hd)
+		}
+	}
+	if err := hf.AddHeader(headers[0]); err == nil {
+		t.Error("expected error adding duplicate header")
+	}
+	absent, _ := ParseHeader("ZZZ-ZZZZZ-ZZ-999.99", false)
+	if hf.Has(absent) {
+		t.Errorf("filter should not contain %s", absent)
+	}
+	for _, query := range []string{"LHC", "SPS-M", "LHC-MA", "LHC-MAG-QA", "QA", "MB", "SPS-DR", headers[5].String()} {
+		dst := make([]Header, len(headers))
+		n, total := hf.HumanQuery(dst, query, 0)
+		expect := linearQuery(headers, query)
+		if n != total || total != expect {
+			t.Errorf("query %q: expected %d matches, got n=%d total=%d", query, expect, n, total)
+		}
+		for i := 1; i < n; i++ {
+			if compareHeaders(dst[i-1], dst[i]) >= 0 {
+				t.Errorf("query %q: results not sorted %s, %s", query, dst[i-1], dst[i])
+				break
+			}
+		}
+	}
+	var last Header
+	count := 0
+	hf.DoCodes(headers[0], func(_ int, h Header) error {
+		if !HeaderCodesEqual(h, headers[0]) {
+			t.Errorf("DoCodes yielded %s for codes of %s", h, headers[0])
+		}
+		if count > 0 && compareHeaders(last, h) >= 0 {
+			t.Errorf("DoCodes not ordered %s, %s", last, h)
+		}
+		last = h
+		count++
+		return nil
+	})
+	expect := 0
+	for _, h := range headers {
+		if HeaderCodesEqual(h, headers[0]) {
+			expect++
+		}
+	}
+	if count != expect {
+		t.Errorf("DoCodes expected %d headers, got %d", expect, count)
+	}
+}
+
+func BenchmarkHeaderFilterHas(b *testing.B) {
+	for _, n := range []int{1000, 200_000} {
+		headers := randomHeaders(rand.New(rand.NewSource(1)), n)
+		hf := NewHeaderFilter(headers)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !hf.Has(headers[i%n]) {
+					b.Fatal("header not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHeaderFilterAddHeader(b *testing.B) {
+	for _, n := range []int{1000, 10_000} {
+		headers := randomHeaders(rand.New(rand.NewSource(1)), n)
+		b.Run(fmt.Sprintf("n=%d/indexed", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var hf HeaderFilter
+				for _, h := range headers {
+					if err := hf.AddHeader(h); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("n=%d/batch", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var hf HeaderFilter
+				if err := hf.AddHeaders(headers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("n=%d/baseline", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var hf linearHeaderFilter
+				for _, h := range headers {
+					if err := hf.addHeader(h); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// linearHeaderFilter adds headers as HeaderFilter did before it was indexed,
+// testing for duplicates with a linear scan. It serves as the baseline of
+// BenchmarkHeaderFilterAddHeader.
+type linearHeaderFilter struct {
+	data       []Header
+	projects   [][capP]byte
+	attachment []uint8
+	number     []int32
+	deleted    []bool
+	equipment  [capE][]byte
+	document   [capDT][]byte
+}
+
+func (hf *linearHeaderFilter) addHeader(h Header) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	for i := range hf.data {
+		if !hf.deleted[i] && HeadersEqual(hf.data[i], h) {
+			return errors.New("header already present")
+		}
+	}
+	hf.data = append(hf.data, h)
+	hf.number = append(hf.number, h.Number)
+	hf.projects = append(hf.projects, h.ProjectCode)
+	hf.attachment = append(hf.attachment, h.AttachmentNumber)
+	hf.deleted = append(hf.deleted, false)
+	for j := 0; j < capE; j++ {
+		hf.equipment[j] = append(hf.equipment[j], h.EquipmentCode[j])
+	}
+	for j := 0; j < capDT; j++ {
+		hf.document[j] = append(hf.document[j], h.DocumentTypeCode[j])
+	}
+	return nil
+}
+
+func BenchmarkHeaderFilterHumanQuery(b *testing.B) {
+	dst := make([]Header, 40)
+	for _, n := range []int{1000, 200_000} {
+		headers := randomHeaders(rand.New(rand.NewSource(1)), n)
+		hf := NewHeaderFilter(headers)
+		for _, query := range []string{"LHC-MAG", "SPS-M-DR"} {
+			b.Run(fmt.Sprintf("n=%d/%s", n, query), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					hf.HumanQuery(dst, query, 0)
+				}
+			})
+			b.Run(fmt.Sprintf("n=%d/%s/baseline", n, query), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					linearQuery(headers, query)
+				}
+			})
+		}
+	}
+}
+
+// randomHeaders returns n distinct valid headers with codes drawn
+// from small sets so that queries have many matches.
+func randomHeaders(rng *rand.Rand, n int) []Header {
+	projects := []string{"LHC", "SPS", "PSB", "ISO", "AWA"}
+	equipment := []string{"M", "MA", "MAG", "MB", "MBX", "PEC", "UPPE1", "DR", "CRY", "VAC"}
+	doctypes := []string{"QA", "DR", "HP", "TP", "MB"}
+	seen := make(map[Header]bool, n)
+	headers := make([]Header, 0, n)
+	for len(headers) < n {
+		name := fmt.Sprintf("%s-%s-%s-%03d.%02d", projects[rng.Intn(len(projects))],
+			equipment[rng.Intn(len(equipment))], doctypes[rng.Intn(len(doctypes))],
+			1+rng.Intn(maxDocumentNumber), rng.Intn(3))
+		hd, err := ParseHeader(name, false)
+		if err != nil {
+			panic(err)
+		}
+		if !seen[hd] {
+			seen[hd] = true
+			headers = append(headers, hd)
+		}
+	}
+	return headers
+}
+
+// linearQuery counts the headers matched by a human query by scanning all
+// headers as HeaderFilter did before it was indexed. It serves as the
+// baseline of BenchmarkHeaderFilterHumanQuery.
+func linearQuery(headers []Header, query string) (found int) {
+	if hd, err := ParseHeader(query, false); err == nil {
+		for _, h := range headers {
+			if HeadersEqual(h, hd) {
+				return 1
+			}
+		}
+	}
+	proj, equip, docT := ParseDocumentCodes(query)
+	matchProj, matchEquip, matchDocT := len(proj) == lenP, equip != "", len(docT) == lenDT
+	if !matchProj && !matchEquip && !matchDocT {
+		return 0
+	}
+	for _, h := range headers {
+		eq := h.Equipment()
+		if (!matchProj || h.Project() == proj) &&
+			(!matchEquip || len(eq) >= len(equip) && eq[:len(equip)] == equip) &&
+			(!matchDocT || h.DocumentType() == docT) {
+			found++
+		}
+	}
+	return found
+}
+
+func TestHeaderFilterAddHeaders(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(5)), 200)
+	hf := NewHeaderFilter(headers[:50])
+	if err := hf.AddHeaders(headers[50:]); err != nil {
+		t.Fatal(err)
+	}
+	expect := NewHeaderFilter(headers)
+	dst, expectDst := make([]Header, 200), make([]Header, 200)
+	for _, query := range []string{"LHC", "SPS-M", "PSB-MA-HP", "QA"} {
+		n, total := hf.HumanQuery(dst, query, 0)
+		expectN, expectTotal := expect.HumanQuery(expectDst, query, 0)
+		if n != expectN || total != expectTotal {
+			t.Fatalf("%q: expected %d/%d matches, got %d/%d", query, expectN, expectTotal, n, total)
+		}
+		for i := 0; i < n; i++ {
+			if dst[i] != expectDst[i] {
+				t.Errorf("%q: expected match %d to be %s, got %s", query, i, expectDst[i], dst[i])
+			}
+		}
+	}
+	extra := randomHeaders(rand.New(rand.NewSource(6)), 10)
+	for _, bad := range [][]Header{append(extra, headers[0]), append(extra, extra[0]), append(extra, Header{})} {
+		if err := hf.AddHeaders(bad); err == nil {
+			t.Error("expected error adding present, repeated or invalid header")
+		}
+		if hf.Len() != len(headers) {
+			t.Fatalf("expected filter unmodified after failed batch, got %d headers", hf.Len())
+		}
+	}
+}
+
+func TestHeaderFilterRemove(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(2)), 100)
+	hf := NewHeaderFilter(headers[:50])
+	for _, hd := range headers[50:] {
+		if err := hf.AddHeader(hd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < len(headers); i += 2 {
+		if err := hf.Remove(headers[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hf.Remove(headers[0]); err == nil {
+		t.Error("expected error removing absent header")
+	}
+	renamed, _ := ParseHeader("ZZZ-ZZZZZ-ZZ-999.99", false)
+	if err := hf.Replace(headers[1], renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := hf.Replace(headers[3], renamed); err == nil {
+		t.Error("expected error replacing with present header")
+	}
+	if err := hf.Replace(headers[0], headers[2]); err == nil {
+		t.Error("expected error replacing absent header")
+	}
+	check := func() {
+		t.Helper()
+		if hf.Len() != len(headers)/2 {
+			t.Errorf("expected %d headers, got %d", len(headers)/2, hf.Len())
+		}
+		for i, hd := range headers {
+			if expect := i%2 == 1 && i != 1; hf.Has(hd) != expect {
+				t.Errorf("expected Has(%s) == %t", hd, expect)
+			}
+		}
+		if !hf.Has(renamed) {
+			t.Error("expected replaced header in filter")
+		}
+		count := 0
+		hf.Do(func(_ int, h Header) error {
+			count++
+			return nil
+		})
+		dst := make([]Header, len(headers))
+		_, total := hf.HumanQuery(dst, "LHC", 0)
+		expect := 0
+		for _, h := range append(headers, renamed) {
+			if hf.Has(h) && h.Project() == "LHC" {
+				expect++
+			}
+		}
+		if count != hf.Len() || total != expect {
+			t.Errorf("removed headers visited: Do visited %d, query found %d, expected %d", count, total, expect)
+		}
+	}
+	check()
+	if hf.Tombstones() != len(headers)/2+1 {
+		t.Errorf("expected %d tombstones, got %d", len(headers)/2+1, hf.Tombstones())
+	}
+	hf.Compact()
+	if hf.Tombstones() != 0 {
+		t.Errorf("expected no tombstones after compaction, got %d", hf.Tombstones())
+	}
+	check()
+	if err := hf.AddHeader(headers[0]); err != nil {
+		t.Errorf("adding removed header: %s", err)
+	}
+}
@@ -0,0 +1,176 @@
+package qap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeLevel is the level of a node in a project's equipment code hierarchy.
+// The level of a node is the length of its equipment code.
+type NodeLevel uint8
+
+const (
+	LevelSystem NodeLevel = iota + 1
+	LevelFamily
+	LevelType
+	LevelModel
+	LevelVariant
+)
+
+func (l NodeLevel) String() string {
+	switch l {
+	case LevelSystem:
+		return "system"
+	case LevelFamily:
+		return "family"
+	case LevelType:
+		return "type"
+	case LevelModel:
+		return "model"
+	case LevelVariant:
+		return "variant"
+	}
+	return "<invalid level>"
+}
+
+// Node is a system, family, type, model or variant of a project's equipment structure.
+type Node struct {
+	Level NodeLevel
+	// Code is the equipment code of the node i.e. "MVR" for a type.
+	Code        string
+	Name        string
+	Description string
+}
+
+func (n Node) String() string {
+	if n.Name == "" {
+		return n.Code
+	}
+	return n.Name
+}
+
+// NodePath returns the human readable path of nodes as returned by
+// Project.Resolve i.e. "Engines > Vacuum > Raptor".
+func NodePath(nodes []Node) string {
+	names := make([]string, len(nodes))
+	for i := range nodes {
+		names[i] = nodes[i].String()
+	}
+	return strings.Join(names, " > ")
+}
+
+// Resolve returns the chain of nodes from the system down to the last
+// level of equipmentCode, i.e. the system, family and type of "MVR". Codes
+// of a serial range resolve to a last node named after the range and serial,
+// i.e. "Unit 01" for "MVR01". If a level is not found in the structure
+// Resolve returns the nodes resolved up to that level and an error.
+func (p Project) Resolve(equipmentCode string) ([]Node, error) {
+	if len(equipmentCode) == 0 || len(equipmentCode) > lenE {
+		return nil, ErrBadEquipmentCode
+	}
+	nodes := make([]Node, 0, len(equipmentCode))
+	for i := 1; i <= len(equipmentCode); i++ {
+		n, err := p.node(equipmentCode[:i])
+		if sr, ok := p.serialRange(equipmentCode); err != nil && ok && len(sr.Prefix) == i-1 {
+			serial := equipmentCode[i-1:]
+			return append(nodes, Node{
+				Level:       NodeLevel(len(equipmentCode)),
+				Code:        equipmentCode,
+				Name:        strings.TrimSpace(sr.Name + " " + serial),
+				Description: sr.Description,
+			}), nil
+		}
+		if err != nil {
+			return nodes, err
+		}
+		nodes = append(nodes, Node{
+			Level:       NodeLevel(i),
+			Code:        equipmentCode[:i],
+			Name:        *n.name,
+			Description: *n.desc,
+		})
+	}
+	return nodes, nil
+}
+
+// Walk calls fn for every node in the project structure depth first with
+// systems, families, types, models and variants in the order they were added.
+// If fn returns an error Walk stops and returns it.
+func (p Project) Walk(fn func(n Node) error) error {
+	for _, sys := range p.Systems {
+		code := string(sys.Code)
+		if err := fn(Node{LevelSystem, code, sys.Name, sys.Description}); err != nil {
+			return err
+		}
+		for _, fam := range sys.Families {
+			code := code + string(fam.Code)
+			if err := fn(Node{LevelFamily, code, fam.Name, fam.Description}); err != nil {
+				return err
+			}
+			for _, tp := range fam.Types {
+				code := code + string(tp.Code)
+				if err := fn(Node{LevelType, code, tp.Name, tp.Description}); err != nil {
+					return err
+				}
+				for _, model := range tp.Models {
+					code := code + string(model.Code)
+					if err := fn(Node{LevelModel, code, model.Name, model.Description}); err != nil {
+						return err
+					}
+					for _, variant := range model.Variants {
+						code := code + string(variant.Code)
+						if err := fn(Node{LevelVariant, code, variant.Name, variant.Description}); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// FindNodes returns the nodes whose name is name ignoring case. It is the
+// reverse of Resolve, i.e. FindNodes("raptor") may return the type "MVR".
+func (p Project) FindNodes(name string) []Node {
+	name = strings.TrimSpace(name)
+	var found []Node
+	p.Walk(func(n Node) error {
+		if strings.EqualFold(n.Name, name) {
+			found = append(found, n)
+		}
+		return nil
+	})
+	return found
+}
+
+// Complete returns the children of the node with equipment code partial in the
+// order they were added, i.e. the families of system "M" for partial "M",
+// followed by the serials of the serial ranges under partial. The empty
+// partial returns the project's systems. Complete returns an error if
+// partial is not in the structure. Codes of the returned nodes are therefore
+// always accepted by ContainsCode, except for serial ranges too large to be
+// listed, which are returned as a single node whose code is the range pattern.
+func (p Project) Complete(partial string) ([]Node, error) {
+	if len(partial) >= lenE {
+		return nil, fmt.Errorf("equipment code %s has no further levels", partial)
+	}
+	if partial != "" {
+		if _, err := p.node(partial); err != nil {
+			return nil, err
+		}
+	}
+	var children []Node
+	p.Walk(func(n Node) error {
+		if len(n.Code) == len(partial)+1 && strings.HasPrefix(n.Code, partial) {
+			children = append(children, n)
+		}
+		return nil
+	})
+	for _, sr := range p.Serials {
+		if sr.Prefix == partial {
+			children = append(children, sr.completions()...)
+		}
+	}
+	return children, nil
+}
@@ -0,0 +1,141 @@
+package qap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProjectResolve(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, n := range []struct{ code, name string }{
+		{"M", "Engines"}, {"MV", "Vacuum"}, {"MVR", "Raptor"}, {"MVRB", "Raptor-B"},
+		{"MVRBX", "Raptor-B-X"}, {"X", "Structure"}, {"XR", "raptor"},
+	} {
+		if err := p.AddEquipmentCode(n.code, n.name, "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodes, err := p.Resolve("MVR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := NodePath(nodes); got != "Engines > Vacuum > Raptor" {
+		t.Errorf("unexpected path %q", got)
+	}
+	if nodes[2].Level != LevelType || nodes[2].Code != "MVR" || nodes[2].Description != "desc" {
+		t.Errorf("unexpected type node %+v", nodes[2])
+	}
+	nodes, err = p.Resolve("MVRBX")
+	if err != nil || len(nodes) != 5 || nodes[4].Level != LevelVariant {
+		t.Errorf("expected 5 levels for variant, got %v %v", nodes, err)
+	}
+	nodes, err = p.Resolve("MVZ")
+	if err == nil || len(nodes) != 2 {
+		t.Errorf("expected partial resolution and error, got %v %v", nodes, err)
+	}
+	if _, err := p.Resolve(""); err == nil {
+		t.Error("expected error resolving empty code")
+	}
+	found := p.FindNodes(" RAPTOR ")
+	if len(found) != 2 || found[0].Code != "MVR" || found[1].Code != "XR" {
+		t.Errorf("unexpected reverse lookup %v", found)
+	}
+	count := 0
+	p.Walk(func(n Node) error {
+		if int(n.Level) != len(n.Code) {
+			t.Errorf("node %s has level %s", n.Code, n.Level)
+		}
+		count++
+		return nil
+	})
+	if count != 7 {
+		t.Errorf("expected to walk 7 nodes, got %d", count)
+	}
+}
+
+func TestProjectComplete(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MVX", "MB", "X", "MVRA", "MVRAB"} {
+		if err := p.AddEquipmentCode(code, "name "+code, "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		partial string
+		want    []string
+		err     bool
+	}{
+		{"", []string{"M", "X"}, false},
+		{"M", []string{"MV", "MB"}, false},
+		{"MV", []string{"MVR", "MVX"}, false},
+		{"MVX", nil, false},
+		{"MVRA", []string{"MVRAB"}, false},
+		{"MVRAB", nil, true},
+		{"MQ", nil, true},
+		{"m", nil, true},
+	} {
+		nodes, err := p.Complete(test.partial)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error %v", test.partial, err)
+		}
+		var got []string
+		for _, n := range nodes {
+			got = append(got, n.Code)
+			hd := Header{ProjectCode: p.Code}
+			copy(hd.EquipmentCode[:], n.Code)
+			if !p.ContainsCode(hd) || n.Name != "name "+n.Code {
+				t.Errorf("%q: bad completion %+v", test.partial, n)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%q: got %v, want %v", test.partial, got, test.want)
+		}
+	}
+}
+
+func TestProjectCompleteSerials(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MB"} {
+		if err := p.AddEquipmentCode(code, "name "+code, "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, pattern := range []string{"MVR[01-03]", "MB###"} {
+		sr, err := ParseSerialRange(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr.Name = "Unit"
+		if err := p.AddSerialRange(sr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		partial string
+		want    []string
+	}{
+		{"MVR", []string{"MVR01", "MVR02", "MVR03"}},
+		{"MB", []string{"MB###"}},
+		{"M", []string{"MV", "MB"}},
+	} {
+		nodes, err := p.Complete(test.partial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range nodes {
+			got = append(got, n.Code)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%q: got %v, want %v", test.partial, got, test.want)
+		}
+	}
+	nodes, _ := p.Complete("MVR")
+	resolved, err := p.Resolve(nodes[0].Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resolved[len(resolved)-1]; got != nodes[0] {
+		t.Errorf("expected completed serial %+v to resolve to the same node, got %+v", nodes[0], got)
+	}
+}
@@ -0,0 +1,175 @@
+package qap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// NumberingScope determines which documents share a sequence of document numbers.
+type NumberingScope uint8
+
+const (
+	// ScopeCodes documents with the same project, equipment and document type
+	// codes share a sequence of numbers. This is the QAP202 numbering.
+	ScopeCodes NumberingScope = iota
+	// ScopeProject documents of a project share a sequence of numbers so
+	// that document numbers are unique within the project.
+	ScopeProject
+	// ScopeDocumentType documents of a project with the same document type
+	// code share a sequence of numbers regardless of their equipment code.
+	ScopeDocumentType
+)
+
+// NumberRange is an inclusive range of document numbers.
+type NumberRange struct {
+	Min, Max int32
+}
+
+// NumberingPolicy configures how document numbers are allocated by
+// HeaderFilter.NextNumber. The zero value allocates the number following
+// the highest number in use among documents with the same codes, starting at 1.
+type NumberingPolicy struct {
+	Scope NumberingScope
+	// Min is the lowest number allocated. If zero numbers start at 1.
+	Min int32
+	// Reserved number ranges are never allocated.
+	Reserved []NumberRange `json:",omitempty"`
+	// ReuseGaps allocates the lowest free number instead of
+	// the number following the highest number in use.
+	ReuseGaps bool
+}
+
+// Validate tests the policy for malformed data.
+func (p NumberingPolicy) Validate() error {
+	if p.Scope > ScopeDocumentType {
+		return errors.New("unknown numbering scope")
+	}
+	if p.Min < 0 || p.Min > maxDocumentNumber {
+		return ErrInvalidNumber
+	}
+	for _, r := range p.Reserved {
+		if r.Min > r.Max || r.Min < 0 || r.Max > maxDocumentNumber {
+			return fmt.Errorf("invalid reserved number range %d..%d", r.Min, r.Max)
+		}
+	}
+	return nil
+}
+
+// SetNumberingPolicy sets the numbering policy used by NextNumber for
+// documents of project.
+func (hf *HeaderFilter) SetNumberingPolicy(project string, policy NumberingPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	var code [capP]byte
+	if len(project) == 0 || len(project) > capP {
+		return ErrBadProjectCode
+	}
+	copy(code[:], project)
+	if hf.numbering == nil {
+		hf.numbering = make(map[[capP]byte]NumberingPolicy)
+	}
+	hf.numbering[code] = policy
+	return nil
+}
+
+// NextNumber returns the number to be given to a new document with the
+// given codes according to the numbering policy of the project. See
+// SetNumberingPolicy. Numbers of main documents removed from the filter are
+// never allocated again, see Retire. If there are no numbers left to allocate NextNumber
+// returns an error wrapping ErrNumberOverflow.
+func (hf *HeaderFilter) NextNumber(project, equipment, docType string) (int32, error) {
+	hd, err := headerFromCodes(project, equipment, docType)
+	if err != nil {
+		return 0, err
+	}
+	policy := hf.numbering[hd.ProjectCode]
+	used := hf.usedNumbers(policy.Scope, &hd)
+	next := policy.Min
+	if next < 1 {
+		next = 1
+	}
+	if !policy.ReuseGaps && len(used) > 0 && used[len(used)-1] >= next {
+		next = used[len(used)-1] + 1
+	}
+	// Skip used numbers and reserved ranges until a free number is found.
+	for {
+		skipped := false
+		for _, r := range policy.Reserved {
+			if next >= r.Min && next <= r.Max {
+				next = r.Max + 1
+				skipped = true
+			}
+		}
+		if i := sort.Search(len(used), func(i int) bool { return used[i] >= next }); i < len(used) && used[i] == next {
+			next++
+			skipped = true
+		}
+		if !skipped || next > maxDocumentNumber {
+			break
+		}
+	}
+	if next > maxDocumentNumber {
+		return 0, fmt.Errorf("%w for %s-%s-%s", ErrNumberOverflow, project, equipment, docType)
+	}
+	return next, nil
+}
+
+// AddNextNumber allocates the next document number for the given codes
+// as NextNumber does and adds the resulting main document header to the filter.
+func (hf *HeaderFilter) AddNextNumber(project, equipment, docType string) (Header, error) {
+	number, err := hf.NextNumber(project, equipment, docType)
+	if err != nil {
+		return Header{}, err
+	}
+	hd, _ := headerFromCodes(project, equipment, docType)
+	hd.Number = number
+	return hd, hf.AddHeader(hd)
+}
+
+// usedNumbers returns the sorted document numbers in use or retired
+// within scope by headers sharing codes with h.
+func (hf *HeaderFilter) usedNumbers(scope NumberingScope, h *Header) []int32 {
+	key := headerCodes(h)
+	prefix := key[:]
+	if scope != ScopeCodes {
+		prefix = key[:capP]
+	}
+	lo, hi := hf.prefixRange(prefix)
+	var used []int32
+	for _, i := range hf.sorted[lo:hi] {
+		hd := &hf.data[i]
+		if hf.deleted[i] || scope == ScopeDocumentType && hd.DocumentTypeCode != h.DocumentTypeCode {
+			continue
+		}
+		used = append(used, hd.Number)
+	}
+	lo, hi = hf.retiredRange(prefix)
+	for _, hd := range hf.retired[lo:hi] {
+		if scope == ScopeDocumentType && hd.DocumentTypeCode != h.DocumentTypeCode {
+			continue
+		}
+		used = append(used, hd.Number)
+	}
+	if scope != ScopeCodes || hi > lo {
+		sort.Slice(used, func(i, j int) bool { return used[i] < used[j] })
+	}
+	return used
+}
+
+// headerFromCodes returns a validated main document header
+// with the given codes and a zero document number.
+func headerFromCodes(project, equipment, docType string) (Header, error) {
+	var hd Header
+	if len(project) > capP || len(equipment) > capE || len(docType) > capDT {
+		return Header{}, errors.New("document code too long")
+	}
+	copy(hd.ProjectCode[:], project)
+	copy(hd.EquipmentCode[:], equipment)
+	copy(hd.DocumentTypeCode[:], docType)
+	if err := hd.Validate(); err != nil {
+		return Header{}, err
+	}
+	return hd, nil
+}
@@ -0,0 +1,127 @@
+package qap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNextNumber(t *testing.T) {
+	var headers []Header
+	for _, name := range []string{
+		"LHC-PM-QA-001.00", "LHC-PM-QA-002.00", "LHC-PM-QA-002.01", "LHC-PM-QA-005.00",
+		"LHC-PM-DR-010.00", "LHC-MB-QA-007.00", "SPS-PM-QA-003.00",
+	} {
+		hd, err := ParseHeader(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, hd)
+	}
+	for _, test := range []struct {
+		policy NumberingPolicy
+		codes  [3]string
+		expect int32
+	}{
+		{codes: [3]string{"LHC", "PM", "QA"}, expect: 6},
+		{codes: [3]string{"LHC", "PM", "HP"}, expect: 1},
+		{codes: [3]string{"ISO", "PM", "QA"}, expect: 1},
+		{policy: NumberingPolicy{ReuseGaps: true}, codes: [3]string{"LHC", "PM", "QA"}, expect: 3},
+		{policy: NumberingPolicy{Scope: ScopeProject}, codes: [3]string{"LHC", "PM", "HP"}, expect: 11},
+		{policy: NumberingPolicy{Scope: ScopeProject, ReuseGaps: true}, codes: [3]string{"LHC", "A", "HP"}, expect: 3},
+		{policy: NumberingPolicy{Scope: ScopeDocumentType}, codes: [3]string{"LHC", "A", "QA"}, expect: 8},
+		{policy: NumberingPolicy{Scope: ScopeDocumentType}, codes: [3]string{"LHC", "A", "DR"}, expect: 11},
+		{policy: NumberingPolicy{Min: 100}, codes: [3]string{"LHC", "PM", "QA"}, expect: 100},
+		{policy: NumberingPolicy{Reserved: []NumberRange{{6, 9}}}, codes: [3]string{"LHC", "PM", "QA"}, expect: 10},
+		{policy: NumberingPolicy{ReuseGaps: true, Reserved: []NumberRange{{3, 3}, {4, 4}}}, codes: [3]string{"LHC", "PM", "QA"}, expect: 6},
+		{policy: NumberingPolicy{ReuseGaps: true, Min: 2, Reserved: []NumberRange{{6, 9}}}, codes: [3]string{"LHC", "PM", "QA"}, expect: 3},
+	} {
+		hf := NewHeaderFilter(headers)
+		if err := hf.SetNumberingPolicy("LHC", test.policy); err != nil {
+			t.Fatal(err)
+		}
+		got, err := hf.NextNumber(test.codes[0], test.codes[1], test.codes[2])
+		if err != nil {
+			t.Errorf("%v %+v: %s", test.codes, test.policy, err)
+		} else if got != test.expect {
+			t.Errorf("%v %+v: expected number %d, got %d", test.codes, test.policy, test.expect, got)
+		}
+	}
+}
+
+func TestNextNumberOverflow(t *testing.T) {
+	last, _ := ParseHeader("LHC-PM-QA-999999.00", false)
+	hf := NewHeaderFilter([]Header{last})
+	_, err := hf.NextNumber("LHC", "PM", "QA")
+	if !errors.Is(err, ErrNumberOverflow) {
+		t.Errorf("expected overflow error, got %v", err)
+	}
+	hf = NewHeaderFilter(nil)
+	hf.SetNumberingPolicy("LHC", NumberingPolicy{Reserved: []NumberRange{{1, maxDocumentNumber}}})
+	_, err = hf.NextNumber("LHC", "PM", "QA")
+	if !errors.Is(err, ErrNumberOverflow) {
+		t.Errorf("expected overflow error with fully reserved range, got %v", err)
+	}
+	if err := hf.SetNumberingPolicy("LHC", NumberingPolicy{Reserved: []NumberRange{{5, 1}}}); err == nil {
+		t.Error("expected error setting policy with empty reserved range")
+	}
+}
+
+func TestAddNextNumber(t *testing.T) {
+	var hf HeaderFilter
+	for i := int32(1); i <= 3; i++ {
+		hd, err := hf.AddNextNumber("LHC", "PM", "QA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hd.Number != i || !hf.Has(hd) {
+			t.Errorf("expected allocated header number %d in filter, got %s", i, hd)
+		}
+	}
+	if _, err := hf.AddNextNumber("LHC", "PM", "Q1"); err == nil {
+		t.Error("expected error allocating number for invalid codes")
+	}
+}
+
+func TestNextNumberRemoved(t *testing.T) {
+	var headers []Header
+	for _, name := range []string{"LHC-PM-QA-001.00", "LHC-PM-QA-002.00", "LHC-PM-QA-003.00"} {
+		hd, _ := ParseHeader(name, false)
+		headers = append(headers, hd)
+	}
+	for _, policy := range []NumberingPolicy{{}, {ReuseGaps: true}, {Scope: ScopeProject}} {
+		hf := NewHeaderFilter(headers)
+		hf.SetNumberingPolicy("LHC", policy)
+		if err := hf.Remove(headers[2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.Remove(headers[1]); err != nil {
+			t.Fatal(err)
+		}
+		hf.Compact()
+		b, err := hf.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		got, err := hf.NextNumber("LHC", "PM", "QA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 4 {
+			t.Errorf("%+v: expected removed numbers to not be allocated, got %d", policy, got)
+		}
+	}
+	hf := NewHeaderFilter(nil)
+	if err := hf.Retire(headers[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := hf.NextNumber("LHC", "PM", "QA"); got != 3 {
+		t.Errorf("expected number following retired number, got %d", got)
+	}
+	attachment, _ := ParseHeader("LHC-PM-QA-001.01", false)
+	if err := hf.Retire(attachment); err == nil {
+		t.Error("expected error retiring attachment")
+	}
+}
@@ -0,0 +1,337 @@
+package qap
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Query is a compiled header query created by ParseQuery. The zero value
+// Query matches all headers.
+//
+// A query is composed of terms separated by spaces. A header matches the
+// query if it matches all of its terms. Supported terms are:
+//
+//	LHC-M*-DR        project, equipment and document type codes. Trailing codes may be omitted.
+//	LHC-M            a trailing equipment code matches as a prefix, same as "LHC-M*".
+//	LHC-PM-QA-202.00 complete header or header without attachment number.
+//	P:LHC|SPS        project code is any of the alternatives.
+//	E:M*|PEC         equipment code is any of the alternatives. Use "E:M" to match "M" only.
+//	DT:DR|QA         document type code is any of the alternatives.
+//	#100..250        document number in inclusive range. Either bound may be omitted i.e. "#..250".
+//	.00              main documents only. Any attachment number may be used i.e. ".03".
+//	.>0              attachments only. Attachment numbers may also be compared with "<".
+//
+// Codes accept the wildcards "*", which matches any amount of characters,
+// and "?", which matches a single character. Number and attachment terms
+// accept alternatives separated by "|" i.e. "#1..9|100". Any term may be
+// negated by prefixing it with "!" i.e. "!DT:QA".
+type Query struct {
+	src   string
+	terms []queryTerm
+}
+
+// QueryError is returned by ParseQuery for malformed queries.
+type QueryError struct {
+	// Pos is the byte offset in the query where the error was found.
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query position %d: %s", e.Pos, e.Msg)
+}
+
+type queryField uint8
+
+const (
+	fieldProject queryField = iota
+	fieldEquipment
+	fieldDocType
+	fieldNumber
+	fieldAttachment
+)
+
+// queryTerm matches headers matching all of its conditions.
+// If negate is set the match is inverted.
+type queryTerm struct {
+	negate bool
+	conds  []queryCond
+}
+
+// queryCond matches a header field against any of its alternatives.
+// Code fields use globs and numeric fields use ranges.
+type queryCond struct {
+	field  queryField
+	globs  []string
+	ranges []queryRange
+}
+
+// queryRange is an inclusive range of numeric values.
+type queryRange struct {
+	min, max int64
+}
+
+// ParseQuery parses and compiles a query. See Query for the query syntax.
+// Errors returned are of type *QueryError.
+func ParseQuery(query string) (Query, error) {
+	q := Query{src: strings.TrimSpace(query)}
+	pos := 0
+	for pos < len(query) {
+		if query[pos] == ' ' {
+			pos++
+			continue
+		}
+		end := strings.IndexByte(query[pos:], ' ')
+		if end < 0 {
+			end = len(query)
+		} else {
+			end += pos
+		}
+		term, err := parseQueryTerm(query[pos:end], pos)
+		if err != nil {
+			return Query{}, err
+		}
+		q.terms = append(q.terms, term)
+		pos = end
+	}
+	return q, nil
+}
+
+// String returns the query as it was parsed.
+func (q Query) String() string { return q.src }
+
+// Match reports whether the header h matches the query.
+func (q Query) Match(h Header) bool {
+	for _, term := range q.terms {
+		if term.match(&h) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// prefix returns a prefix of the concatenated project, equipment and document type
+// codes shared by all headers matching the query. It is used to narrow down searches
+// on indexed headers.
+func (q Query) prefix() []byte {
+	for _, term := range q.terms {
+		if term.negate {
+			continue
+		}
+		var codes [3]*queryCond
+		for i := range term.conds {
+			if c := &term.conds[i]; c.field <= fieldDocType && len(c.globs) == 1 {
+				codes[c.field] = c
+			}
+		}
+		if codes[fieldProject] == nil {
+			continue
+		}
+		var prefix []byte
+		for i, size := range [3]int{capP, capE, capDT} {
+			if codes[i] == nil {
+				break
+			}
+			glob := codes[i].globs[0]
+			literal := glob
+			if wild := strings.IndexAny(glob, "*?"); wild >= 0 {
+				literal = glob[:wild]
+			}
+			prefix = append(prefix, literal...)
+			if literal != glob {
+				break
+			}
+			prefix = append(prefix, make([]byte, size-len(literal))...)
+		}
+		return prefix
+	}
+	return nil
+}
+
+func (t queryTerm) match(h *Header) bool {
+	for _, c := range t.conds {
+		if !c.match(h) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c queryCond) match(h *Header) bool {
+	var code string
+	var value int64
+	switch c.field {
+	case fieldProject:
+		code = h.Project()
+	case fieldEquipment:
+		code = h.Equipment()
+	case fieldDocType:
+		code = h.DocumentType()
+	case fieldNumber:
+		value = int64(h.Number)
+	case fieldAttachment:
+		value = int64(h.AttachmentNumber)
+	}
+	for _, glob := range c.globs {
+		if ok, _ := path.Match(glob, code); ok {
+			return true
+		}
+	}
+	for _, r := range c.ranges {
+		if value >= r.min && value <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQueryTerm parses a single space separated term located at pos in the query.
+func parseQueryTerm(term string, pos int) (queryTerm, error) {
+	var t queryTerm
+	if strings.HasPrefix(term, "!") {
+		t.negate = true
+		term = term[1:]
+		pos++
+	}
+	if term == "" {
+		return t, &QueryError{Pos: pos, Msg: "empty negated term"}
+	}
+	var err error
+	var cond queryCond
+	switch {
+	case term[0] == '#':
+		cond, err = parseRangeCond(fieldNumber, term[1:], pos+1, maxDocumentNumber)
+		t.conds = []queryCond{cond}
+	case term[0] == '.':
+		cond, err = parseRangeCond(fieldAttachment, term[1:], pos+1, maxAttachmentNumber)
+		t.conds = []queryCond{cond}
+	case strings.Contains(term, ":"):
+		name, value, _ := strings.Cut(term, ":")
+		field, ok := map[string]queryField{"P": fieldProject, "E": fieldEquipment, "DT": fieldDocType}[strings.ToUpper(name)]
+		if !ok {
+			return t, &QueryError{Pos: pos, Msg: fmt.Sprintf("unknown field %q, expected P, E or DT", name)}
+		}
+		cond, err = parseGlobCond(field, value, pos+len(name)+1)
+		t.conds = []queryCond{cond}
+	default:
+		t.conds, err = parseCodeConds(term, pos)
+	}
+	return t, err
+}
+
+// parseCodeConds parses a term of the form "PRJ-EQUIP-DT-NUMBER.ATTACHMENT"
+// where all but the project code may be omitted.
+func parseCodeConds(term string, pos int) ([]queryCond, error) {
+	var conds []queryCond
+	fields := [...]queryField{fieldProject, fieldEquipment, fieldDocType}
+	offset := 0
+	for i, part := range strings.SplitN(term, "-", 4) {
+		partPos := pos + offset
+		offset += len(part) + 1
+		if i == len(fields) {
+			// Document number with optional attachment number.
+			number, attachment, hasAttachment := strings.Cut(part, ".")
+			cond, err := parseRangeCond(fieldNumber, number, partPos, maxDocumentNumber)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, cond)
+			if hasAttachment {
+				cond, err = parseRangeCond(fieldAttachment, attachment, partPos+len(number)+1, maxAttachmentNumber)
+				if err != nil {
+					return nil, err
+				}
+				conds = append(conds, cond)
+			}
+			break
+		}
+		cond, err := parseGlobCond(fields[i], part, partPos)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 2 {
+		// A trailing equipment code matches as a prefix like HumanQuery does.
+		for i, glob := range conds[1].globs {
+			if !strings.ContainsAny(glob, "*?") {
+				conds[1].globs[i] = glob + "*"
+			}
+		}
+	}
+	return conds, nil
+}
+
+// parseGlobCond parses "|" separated code globs.
+func parseGlobCond(field queryField, value string, pos int) (queryCond, error) {
+	maxLen := [...]int{fieldProject: capP, fieldEquipment: capE, fieldDocType: capDT}[field]
+	cond := queryCond{field: field}
+	for _, glob := range strings.Split(value, "|") {
+		if glob == "" {
+			return cond, &QueryError{Pos: pos, Msg: "empty code"}
+		}
+		for i := 0; i < len(glob); i++ {
+			if c := glob[i]; !isAlpha(c) && !isNum(c) && c != '*' && c != '?' {
+				return cond, &QueryError{Pos: pos + i, Msg: fmt.Sprintf("invalid character %q in code", c)}
+			}
+		}
+		if !strings.Contains(glob, "*") && len(glob) > maxLen {
+			return cond, &QueryError{Pos: pos, Msg: fmt.Sprintf("code %q longer than %d characters", glob, maxLen)}
+		}
+		cond.globs = append(cond.globs, glob)
+		pos += len(glob) + 1
+	}
+	return cond, nil
+}
+
+// parseRangeCond parses "|" separated numeric values and ranges
+// of the form "N", "A..B", "A..", "..B", ">N" or "<N".
+func parseRangeCond(field queryField, value string, pos int, max int64) (queryCond, error) {
+	cond := queryCond{field: field}
+	parse := func(s string, pos int) (int64, error) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 || v > max {
+			return 0, &QueryError{Pos: pos, Msg: fmt.Sprintf("invalid number %q, expected 0..%d", s, max)}
+		}
+		return v, nil
+	}
+	for _, alt := range strings.Split(value, "|") {
+		r := queryRange{min: 0, max: math.MaxInt64}
+		var err error
+		lo, hi, isRange := strings.Cut(alt, "..")
+		switch {
+		case alt == "":
+			return cond, &QueryError{Pos: pos, Msg: "empty number"}
+		case isRange && lo == "" && hi == "":
+			return cond, &QueryError{Pos: pos, Msg: "range without bounds"}
+		case isRange:
+			if lo != "" {
+				r.min, err = parse(lo, pos)
+			}
+			if hi != "" && err == nil {
+				r.max, err = parse(hi, pos+len(lo)+2)
+			}
+			if err == nil && r.min > r.max {
+				err = &QueryError{Pos: pos, Msg: fmt.Sprintf("empty range %q", alt)}
+			}
+		case alt[0] == '>':
+			r.min, err = parse(alt[1:], pos+1)
+			r.min++
+		case alt[0] == '<':
+			r.max, err = parse(alt[1:], pos+1)
+			r.max--
+		default:
+			r.min, err = parse(alt, pos)
+			r.max = r.min
+		}
+		if err != nil {
+			return cond, err
+		}
+		cond.ranges = append(cond.ranges, r)
+		pos += len(alt) + 1
+	}
+	return cond, nil
+}
@@ -0,0 +1,127 @@
+package qap
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	for _, test := range []struct {
+		Query   string
+		Match   []string
+		NoMatch []string
+	}{
+		{Query: "", Match: []string{"LHC-M-QA-001.00"}},
+		{Query: "LHC-M*-DR", Match: []string{"LHC-M-DR-001.00", "LHC-MAG-DR-002.01"}, NoMatch: []string{"LHC-PM-DR-001.00", "LHC-MAG-QA-001.00", "SPS-M-DR-001.00"}},
+		{Query: "LHC-M", Match: []string{"LHC-M-DR-001.00", "LHC-MAG-DR-001.00"}, NoMatch: []string{"LHC-PM-DR-001.00", "SPS-M-DR-001.00"}},
+		{Query: "LHC-M|PE?", Match: []string{"LHC-MAG-DR-001.00", "LHC-PEC-DR-001.00"}, NoMatch: []string{"LHC-PECS-DR-001.00"}},
+		{Query: "E:M", Match: []string{"LHC-M-DR-001.00"}, NoMatch: []string{"LHC-MAG-DR-001.00"}},
+		{Query: "*-M?G", Match: []string{"SPS-MAG-DR-001.00"}, NoMatch: []string{"SPS-MA-DR-001.00"}},
+		{Query: "#100..250", Match: []string{"LHC-M-DR-100.00", "LHC-M-DR-250.00"}, NoMatch: []string{"LHC-M-DR-099.00", "LHC-M-DR-251.00"}},
+		{Query: "#..2|300..", Match: []string{"LHC-M-DR-001.00", "LHC-M-DR-300.00"}, NoMatch: []string{"LHC-M-DR-003.00"}},
+		{Query: ".00", Match: []string{"LHC-M-DR-001.00"}, NoMatch: []string{"LHC-M-DR-001.01"}},
+		{Query: ".>0", Match: []string{"LHC-M-DR-001.01"}, NoMatch: []string{"LHC-M-DR-001.00"}},
+		{Query: "DT:DR|QA", Match: []string{"LHC-M-DR-001.00", "SPS-A-QA-001.00"}, NoMatch: []string{"LHC-M-HP-001.00"}},
+		{Query: "P:LHC !DT:QA", Match: []string{"LHC-M-DR-001.00"}, NoMatch: []string{"LHC-M-QA-001.00", "SPS-M-DR-001.00"}},
+		{Query: "!LHC-M* E:*G", Match: []string{"SPS-MAG-DR-001.00", "LHC-PMG-DR-001.00"}, NoMatch: []string{"LHC-MAG-DR-001.00"}},
+		{Query: "LHC-PM-QA-202.01", Match: []string{"LHC-PM-QA-202.01"}, NoMatch: []string{"LHC-PM-QA-202.00", "LHC-PM-QA-203.01"}},
+		{Query: "LHC-PM-QA-202", Match: []string{"LHC-PM-QA-202.00", "LHC-PM-QA-202.01"}, NoMatch: []string{"LHC-PM-QA-203.00"}},
+	} {
+		q, err := ParseQuery(test.Query)
+		if err != nil {
+			t.Fatalf("parsing %q: %s", test.Query, err)
+		}
+		for _, name := range append(test.Match, test.NoMatch...) {
+			hd, err := ParseHeader(name, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect := !contains(test.NoMatch, name)
+			if q.Match(hd) != expect {
+				t.Errorf("query %q: expected match of %s to be %t", test.Query, name, expect)
+			}
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, test := range []struct {
+		Query string
+		Pos   int
+	}{
+		{Query: "LHC-", Pos: 4},
+		{Query: "LHC-m", Pos: 4},
+		{Query: "LHC #1..x", Pos: 8},
+		{Query: "X:LHC", Pos: 0},
+		{Query: "DT:QA !", Pos: 7},
+		{Query: ".100", Pos: 1},
+		{Query: "#5..1", Pos: 1},
+		{Query: "P:LHCXX", Pos: 2},
+	} {
+		_, err := ParseQuery(test.Query)
+		var qerr *QueryError
+		if !errors.As(err, &qerr) {
+			t.Errorf("query %q: expected QueryError, got %v", test.Query, err)
+			continue
+		}
+		if qerr.Pos != test.Pos {
+			t.Errorf("query %q: expected error at %d, got %s", test.Query, test.Pos, qerr)
+		}
+	}
+}
+
+func TestHeaderFilterSearch(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(4)), 3000)
+	hf := NewHeaderFilter(headers)
+	for _, query := range []string{"LHC-M*", "LHC-MAG-QA", "SPS-M*-DR #..500000", "P:LHC|SPS .>0 !E:M*", "*-PEC", ""} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := 0
+		for _, hd := range headers {
+			if q.Match(hd) {
+				expect++
+			}
+		}
+		dst := make([]Header, 10)
+		n, total := hf.Search(dst, q, 1)
+		if total != expect || n != min(10, max(0, expect-10)) {
+			t.Errorf("query %q: expected %d matches, got n=%d total=%d", query, expect, n, total)
+		}
+	}
+}
+
+func TestSearchMatchesHumanQuery(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(5)), 3000)
+	hf := NewHeaderFilter(headers)
+	// Queries without query language operators match the same headers
+	// as HumanQuery, in particular a bare trailing equipment code is a prefix.
+	for _, query := range []string{"LHC-M", "SPS-MA", "LHC-MAG-DR", "PSB-UPPE1"} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, expect := hf.HumanQuery(nil, query, 0)
+		if _, total := hf.Search(nil, q, 0); total != expect || expect == 0 {
+			t.Errorf("query %q: expected %d matches as HumanQuery, got %d", query, expect, total)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -38,14 +38,131 @@ func NewRevision() Revision {
 type Revision struct {
 	// Index is the document revision index and is
 	// composed by two digits separated by a dot (or alphanumeric characters).
+	// Its interpretation depends on the revision's Kind.
 	Index [2]byte
 
 	IsRelease bool
+	// Kind is the revision index scheme. The zero value
+	// is the QAP202 scheme described above.
+	Kind RevisionKind
 }
 
 // ParseRevision creates a Revision from a formatted string
-// i.e. "B.3-draft", "A.1"
+// i.e. "B.3-draft", "A.1". See RevisionScheme for other revision index schemes.
 func ParseRevision(revision string) (Revision, error) {
+	return revisionQAP202{}.ParseRevision(revision)
+}
+
+// String returns the revision index as a string. i.e. "A.1-draft" or "A.2"
+// If the DocInfo's revision index is invalid it returns a constant string.
+func (d Revision) String() string {
+	scheme := d.Kind.Scheme()
+	if scheme == nil {
+		return "<invalid revision index>"
+	}
+	return scheme.String(d)
+}
+
+// Validate tests the Revision is valid and returns ErrBadRevisionIndex if it is not.
+func (d Revision) Validate() error {
+	scheme := d.Kind.Scheme()
+	if scheme == nil {
+		return errBadRevisionKind
+	}
+	return scheme.Validate(d)
+}
+
+// IncrementMinor returns the DocInfo with it's minor version incremented by
+// one and IsReleased field set to isRelease argument.
+func (d Revision) IncrementMinor(isRelease bool) (Revision, error) {
+	scheme := d.Kind.Scheme()
+	if scheme == nil {
+		return Revision{}, errBadRevisionKind
+	}
+	return scheme.IncrementMinor(d, isRelease)
+}
+
+// IncrementMajor returns the DocInfo with it's major version incremented by
+// one and IsReleased field set to isRelease argument. QAP202 revisions keep their minor index.
+func (d Revision) IncrementMajor(isRelease bool) (Revision, error) {
+	scheme := d.Kind.Scheme()
+	if scheme == nil {
+		return Revision{}, errBadRevisionKind
+	}
+	return scheme.IncrementMajor(d, isRelease)
+}
+
+// AreSequential tests whether b follows a as a revision, indicating whether
+// the increment between the two revisions is
+//  - A minor revision, which can be either
+//    - A draft to release increment (i.e. A.1-draft -> A.1)
+//    - A minor index increment (i.e. C.2 -> C.3 or C.2 -> C.3-draft)
+//  - A major revision (i.e. A.3 -> B.1 or A.3 -> B.1-draft)
+// It returns false for both minor and major if revisions are not in ascending
+// order, they are not a single increment apart, they are invalid revisions
+// or they are of different kinds.
+func AreSequential(a, b Revision) (minor, major bool) {
+	scheme := a.Kind.Scheme()
+	if scheme == nil || a.Kind != b.Kind {
+		return false, false
+	}
+	return scheme.AreSequential(a, b)
+}
+
+// CompareRevisions returns -1 if a precedes b, 0 if a and b are the same
+// revision and +1 if a follows b. Draft revisions precede the release of the
+// same index. Revisions of different kinds are ordered by their kind.
+func CompareRevisions(a, b Revision) int {
+	scheme := a.Kind.Scheme()
+	if a.Kind != b.Kind || scheme == nil {
+		return cmpByte(byte(a.Kind), byte(b.Kind))
+	}
+	return scheme.Compare(a, b)
+}
+
+// Revisions is a slice of revisions which implements sort.Interface
+// sorting revisions in ascending order. See CompareRevisions.
+type Revisions []Revision
+
+func (r Revisions) Len() int           { return len(r) }
+func (r Revisions) Less(i, j int) bool { return CompareRevisions(r[i], r[j]) < 0 }
+func (r Revisions) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// ValidateHistory tests that the revisions in history are valid and that
+// each revision follows the previous one according to AreSequential. It
+// returns an error describing the first duplicate revision, draft following
+// a release of the same index or non-sequential step found.
+func ValidateHistory(history []Revision) error {
+	for i, rev := range history {
+		if err := rev.Validate(); err != nil {
+			return fmt.Errorf("revision %d (%s): %w", i, rev, err)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := history[i-1]
+		minor, major := AreSequential(prev, rev)
+		switch {
+		case minor || major:
+			continue
+		case prev == rev:
+			return fmt.Errorf("revision %d: duplicate revision %s", i, rev)
+		case prev.Index == rev.Index && prev.IsRelease && !rev.IsRelease:
+			return fmt.Errorf("revision %d: draft %s follows release %s", i, rev, prev)
+		}
+		return fmt.Errorf("revision %d: %s does not follow %s", i, rev, prev)
+	}
+	return nil
+}
+
+// revisionQAP202 implements the revision index scheme described by Revision.
+type revisionQAP202 struct{}
+
+func (revisionQAP202) Kind() RevisionKind { return RevisionQAP202 }
+
+func (revisionQAP202) First() Revision { return NewRevision() }
+
+func (revisionQAP202) ParseRevision(revision string) (Revision, error) {
 	if len(revision) < 3 {
 		return Revision{}, errors.New("revision string must be at least length 3")
 	}
@@ -69,10 +186,8 @@ func ParseRevision(revision string) (Revision, error) {
 	return r, nil
 }
 
-// String returns the revision index as a string. i.e. "A.1-draft" or "A.2"
-// If the DocInfo's revision index is invalid it returns a constant string.
-func (d Revision) String() string {
-	if d.Validate() != nil {
+func (s revisionQAP202) String(d Revision) string {
+	if s.Validate(d) != nil {
 		return "<invalid revision index>"
 	}
 	appendStr := _draftStr
@@ -82,8 +197,10 @@ func (d Revision) String() string {
 	return fmt.Sprintf("%s.%s%s", string(d.Index[0]), string(d.Index[1]), appendStr)
 }
 
-// Validate tests the Revision is valid and returns ErrBadRevisionIndex if it is not.
-func (d Revision) Validate() error {
+func (revisionQAP202) Validate(d Revision) error {
+	if d.Kind != RevisionQAP202 {
+		return errRevisionKindMismatch
+	}
 	if d.Index == (Revision{}).Index {
 		return errors.New("revision not initialized")
 	}
@@ -99,10 +216,8 @@ func (d Revision) Validate() error {
 	return nil
 }
 
-// IncrementMinor returns the DocInfo with it's minor version incremented by
-// one and IsReleased field set to isRelease argument.
-func (d Revision) IncrementMinor(isRelease bool) (Revision, error) {
-	if err := d.Validate(); err != nil {
+func (s revisionQAP202) IncrementMinor(d Revision, isRelease bool) (Revision, error) {
+	if err := s.Validate(d); err != nil {
 		return Revision{}, err
 	}
 	if d.Index[1] == '9' {
@@ -113,10 +228,8 @@ func (d Revision) IncrementMinor(isRelease bool) (Revision, error) {
 	return d, nil
 }
 
-// IncrementMajor returns the DocInfo with it's major version incremented by
-// one and IsReleased field set to isRelease argument.
-func (d Revision) IncrementMajor(isRelease bool) (Revision, error) {
-	if err := d.Validate(); err != nil {
+func (s revisionQAP202) IncrementMajor(d Revision, isRelease bool) (Revision, error) {
+	if err := s.Validate(d); err != nil {
 		return Revision{}, err
 	}
 	if d.Index[0] == 'Z' {
@@ -127,31 +240,27 @@ func (d Revision) IncrementMajor(isRelease bool) (Revision, error) {
 	return d, nil
 }
 
-// AreSequential tests whether b follows a as a revision, indicating whether
-// the increment between the two revisions is
-//  - A minor revision, which can be either
-//    - A draft to release increment (i.e. A.1-draft -> A.1)
-//    - A minor index increment (i.e. C.2 -> C.3 or C.2 -> C.3-draft)
-//  - A major revision (i.e. A.3 -> B.1 or A.3 -> B.1-draft)
-// It returns false for both minor and major if revisions are not in ascending
-// order, they are not a single increment apart or if they are invalid revisions.
-func AreSequential(a, b Revision) (minor, major bool) {
+func (s revisionQAP202) AreSequential(a, b Revision) (minor, major bool) {
 	if a.Index == b.Index {
 		// Take care of draft to release increment case.
 		return !a.IsRelease && b.IsRelease, false
 	}
-	nextMinor, err := a.IncrementMinor(a.IsRelease)
-	if err != nil {
+	if s.Validate(a) != nil {
 		return false, false
 	}
-	nextMajor, err := a.IncrementMajor(a.IsRelease)
-	if err != nil {
-		return false, false
+	// The major step is tested independently of the minor index so that
+	// revisions at the last minor index such as A.9 may still be followed by B.0.
+	if b.Index[0] == a.Index[0] {
+		return a.Index[1] != '9' && b.Index[1] == a.Index[1]+1, false
 	}
-	if b.Index == nextMinor.Index {
-		return true, false
-	} else if b.Index == nextMajor.Index {
-		return false, true
+	if a.Index[0] == 'Z' || b.Index[0] != a.Index[0]+1 {
+		return false, false
 	}
-	return false, false
+	// Major revisions may start at minor index 0 or 1 or keep the minor index
+	// as returned by IncrementMajor.
+	return false, b.Index[1] == '0' || b.Index[1] == '1' || b.Index[1] == a.Index[1]
+}
+
+func (revisionQAP202) Compare(a, b Revision) int {
+	return compareIndex(a, b)
 }
@@ -1,6 +1,9 @@
 package qap
 
-import "testing"
+import (
+	"sort"
+	"testing"
+)
 
 func TestParseRevision(t *testing.T) {
 	for _, test := range []struct {
@@ -43,3 +46,141 @@ func TestParseRevision(t *testing.T) {
 		}
 	}
 }
+
+func TestRevisionSchemes(t *testing.T) {
+	for _, test := range []struct {
+		Kind   RevisionKind
+		Expect []string
+	}{
+		{
+			Kind:   RevisionASME,
+			Expect: []string{"A", "B", "C", "D", "E", "F", "G", "H", "J", "K", "L", "M", "N", "P", "R", "T", "U", "V", "W", "Y", "AA", "AB"},
+		},
+		{
+			Kind:   RevisionNumeric,
+			Expect: []string{"01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11"},
+		},
+	} {
+		scheme := test.Kind.Scheme()
+		rev := scheme.First()
+		for i, expect := range test.Expect {
+			if i > 0 {
+				next, err := rev.IncrementMajor(true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if minor, major := AreSequential(rev, next); minor || !major {
+					t.Errorf("expected %s -> %s to be a major increment", rev, next)
+				}
+				rev = next
+			}
+			if rev.String() != expect && rev.String() != expect+_draftStr {
+				t.Errorf("%s: expected %dth revision %q, got %q", test.Kind, i, expect, rev.String())
+			}
+			parsed, err := scheme.ParseRevision(rev.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed != rev {
+				t.Errorf("%s: parsing %q got %q", test.Kind, rev, parsed)
+			}
+			var unmarshalled Revision
+			err = unmarshalled.UnmarshalText([]byte(rev.String()))
+			if err != nil || unmarshalled != rev {
+				t.Errorf("%s: unmarshalling text %q got %q: %v", test.Kind, rev, unmarshalled, err)
+			}
+		}
+		if _, err := rev.IncrementMinor(false); err == nil {
+			t.Errorf("%s: expected error incrementing minor index", test.Kind)
+		}
+		release := rev
+		release.IsRelease = true
+		rev.IsRelease = false
+		if minor, major := AreSequential(rev, release); !minor || major {
+			t.Errorf("%s: expected draft to release increment %s -> %s to be minor", test.Kind, rev, release)
+		}
+	}
+	qap202 := NewRevision()
+	asme := RevisionASME.Scheme().First()
+	if minor, major := AreSequential(asme, qap202); minor || major {
+		t.Error("expected revisions of different kinds to not be sequential")
+	}
+	for _, invalid := range []string{"I", "AZ", "O-draft", "ABC"} {
+		if _, err := RevisionASME.Scheme().ParseRevision(invalid); err == nil {
+			t.Errorf("expected ASME revision %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestValidateHistory(t *testing.T) {
+	parse := func(revs ...string) []Revision {
+		var history []Revision
+		for _, r := range revs {
+			rev, err := ParseRevision(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history = append(history, rev)
+		}
+		return history
+	}
+	for _, test := range []struct {
+		History []Revision
+		Valid   bool
+	}{
+		{History: parse("A.1-draft", "A.2-draft", "A.2", "A.3", "B.0", "B.1-draft", "B.1"), Valid: true},
+		{History: parse("A.3", "B.1-draft"), Valid: true},
+		{History: parse("A.8", "A.9", "B.0"), Valid: true},
+		{History: parse("A.9", "B.1"), Valid: true},
+		{History: parse("A.9-draft", "A.9", "B.1-draft"), Valid: true},
+		{History: parse("A.9", "B.2")},
+		{History: parse("A.9", "C.0")},
+		{History: parse("A.1-draft", "A.3-draft")},
+		{History: parse("A.2", "A.2")},
+		{History: parse("A.2", "A.2-draft")},
+		{History: parse("B.2", "A.3")},
+	} {
+		err := ValidateHistory(test.History)
+		if test.Valid && err != nil {
+			t.Errorf("expected %v to be valid: %s", test.History, err)
+		} else if !test.Valid && err == nil {
+			t.Errorf("expected %v to be invalid", test.History)
+		}
+	}
+}
+
+func TestSortRevisions(t *testing.T) {
+	asme := RevisionASME.Scheme()
+	var revs Revisions
+	for _, r := range []string{"AA", "B-draft", "Y", "B", "A"} {
+		rev, err := asme.ParseRevision(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+	sort.Sort(revs)
+	var got []string
+	for _, rev := range revs {
+		got = append(got, rev.String())
+	}
+	expect := []string{"A", "B-draft", "B", "Y", "AA"}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("expected sorted %v, got %v", expect, got)
+		}
+	}
+	a, _ := ParseRevision("A.9")
+	// IncrementMajor keeps the minor index.
+	next, err := a.IncrementMajor(true)
+	if err != nil || next.String() != "B.9" {
+		t.Errorf("expected A.9 major increment B.9, got %s %v", next, err)
+	}
+	if minor, major := AreSequential(a, next); minor || !major {
+		t.Errorf("expected %s -> %s to be a major increment", a, next)
+	}
+	b, _ := ParseRevision("B.0-draft")
+	if CompareRevisions(a, b) != -1 || CompareRevisions(b, a) != 1 || CompareRevisions(a, a) != 0 {
+		t.Error("unexpected QAP202 revision comparison")
+	}
+}
@@ -0,0 +1,334 @@
+package qap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RevisionKind identifies a revision index scheme. The zero value
+// is the QAP202 revision index scheme.
+type RevisionKind uint8
+
+const (
+	// RevisionQAP202 revision indices are composed of an upper case letter
+	// followed by a digit i.e. "A.1", "B.3". See Revision.
+	RevisionQAP202 RevisionKind = iota
+	// RevisionASME revision indices follow ASME Y14.35 and are composed of one
+	// or two upper case letters, skipping I, O, Q, S, X and Z i.e. "A", "B", ..., "Y", "AA", "AB".
+	RevisionASME
+	// RevisionNumeric revision indices are composed of two digits i.e. "01", "02".
+	RevisionNumeric
+)
+
+var (
+	errBadRevisionKind      = errors.New("unknown revision kind")
+	errRevisionKindMismatch = errors.New("revision kind does not match revision scheme")
+	errNoMinorIndex         = errors.New("revision scheme has no minor revision index")
+)
+
+// RevisionScheme defines how revision indices of a RevisionKind
+// are parsed, formatted and incremented.
+type RevisionScheme interface {
+	// Kind returns the kind of the revisions handled by the scheme.
+	Kind() RevisionKind
+	// First returns the revision given to newly registered documents.
+	First() Revision
+	// ParseRevision creates a Revision from a formatted string.
+	ParseRevision(revision string) (Revision, error)
+	// String returns the revision formatted as a string.
+	String(r Revision) string
+	// Validate tests the Revision is valid within the scheme.
+	Validate(r Revision) error
+	// IncrementMinor returns the revision with it's minor index incremented.
+	IncrementMinor(r Revision, isRelease bool) (Revision, error)
+	// IncrementMajor returns the revision with it's major index incremented.
+	IncrementMajor(r Revision, isRelease bool) (Revision, error)
+	// AreSequential tests whether b follows a as a revision. See AreSequential.
+	AreSequential(a, b Revision) (minor, major bool)
+	// Compare returns -1 if a precedes b, 0 if a and b are
+	// the same revision and +1 if a follows b.
+	Compare(a, b Revision) int
+}
+
+// Scheme returns the RevisionScheme of the revision kind or nil
+// if the revision kind is not known.
+func (k RevisionKind) Scheme() RevisionScheme {
+	switch k {
+	case RevisionQAP202:
+		return revisionQAP202{}
+	case RevisionASME:
+		return revisionASME{}
+	case RevisionNumeric:
+		return revisionNumeric{}
+	}
+	return nil
+}
+
+// String returns the name of the revision kind i.e. "QAP202", "ASME" or "numeric".
+func (k RevisionKind) String() string {
+	switch k {
+	case RevisionQAP202:
+		return "QAP202"
+	case RevisionASME:
+		return "ASME"
+	case RevisionNumeric:
+		return "numeric"
+	}
+	return "<invalid revision kind>"
+}
+
+// ParseRevisionKind returns the revision kind corresponding to the name
+// returned by RevisionKind.String.
+func ParseRevisionKind(name string) (RevisionKind, error) {
+	for k := RevisionQAP202; k.Scheme() != nil; k++ {
+		if strings.EqualFold(name, k.String()) {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown revision kind %q", name)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (k RevisionKind) MarshalText() ([]byte, error) {
+	if k.Scheme() == nil {
+		return nil, errBadRevisionKind
+	}
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (k *RevisionKind) UnmarshalText(text []byte) error {
+	kind, err := ParseRevisionKind(string(text))
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
+
+// detectRevisionKind returns the kind of a formatted revision string.
+// Revision strings of different kinds are distinguished by their form:
+// QAP202 revisions contain a period, numeric revisions start with a digit
+// and ASME revisions are composed of letters.
+func detectRevisionKind(revision string) RevisionKind {
+	switch {
+	case strings.Contains(revision, "."):
+		return RevisionQAP202
+	case len(revision) > 0 && isNum(revision[0]):
+		return RevisionNumeric
+	}
+	return RevisionASME
+}
+
+// cutDraft removes the draft suffix from revision and reports
+// whether the revision is a release.
+func cutDraft(revision string) (index string, isRelease bool) {
+	if len(revision) > maxRevisionLength {
+		revision = revision[:maxRevisionLength]
+	}
+	isRelease = !strings.HasSuffix(revision, _draftStr)
+	return strings.TrimSuffix(revision, _draftStr), isRelease
+}
+
+// draftSuffix returns the string appended to draft revisions.
+func draftSuffix(r Revision) string {
+	if r.IsRelease {
+		return ""
+	}
+	return _draftStr
+}
+
+// singleIndexSequential implements AreSequential for schemes without a minor index.
+func singleIndexSequential(s RevisionScheme, a, b Revision) (minor, major bool) {
+	if s.Validate(a) != nil || s.Validate(b) != nil {
+		return false, false
+	}
+	if a.Index == b.Index {
+		// Draft to release increment.
+		return !a.IsRelease && b.IsRelease, false
+	}
+	next, err := s.IncrementMajor(a, b.IsRelease)
+	return false, err == nil && next.Index == b.Index
+}
+
+// compareIndex compares revisions by their index bytes and then by release status,
+// draft revisions preceding released revisions of the same index. Indices
+// shorter than two characters must be zero padded.
+func compareIndex(a, b Revision) int {
+	switch {
+	case (a.Index[1] == 0) != (b.Index[1] == 0):
+		// Shorter indices precede longer indices.
+		if a.Index[1] == 0 {
+			return -1
+		}
+		return 1
+	case a.Index[0] != b.Index[0]:
+		return cmpByte(a.Index[0], b.Index[0])
+	case a.Index[1] != b.Index[1]:
+		return cmpByte(a.Index[1], b.Index[1])
+	case a.IsRelease == b.IsRelease:
+		return 0
+	case b.IsRelease:
+		return -1
+	}
+	return 1
+}
+
+func cmpByte(a, b byte) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// asmeLetters are the letters used in ASME Y14.35 revision indices in order.
+const asmeLetters = "ABCDEFGHJKLMNPRTUVWY"
+
+// revisionASME implements the ASME Y14.35 revision index scheme. Single
+// letter indices are stored in Index[0] with Index[1] set to zero.
+type revisionASME struct{}
+
+func (revisionASME) Kind() RevisionKind { return RevisionASME }
+
+func (revisionASME) First() Revision {
+	return Revision{Index: [2]byte{'A', 0}, Kind: RevisionASME}
+}
+
+func (s revisionASME) ParseRevision(revision string) (Revision, error) {
+	index, isRelease := cutDraft(revision)
+	if len(index) < 1 || len(index) > 2 {
+		return Revision{}, errors.New("ASME revision index must be one or two letters")
+	}
+	r := Revision{IsRelease: isRelease, Kind: RevisionASME}
+	copy(r.Index[:], index)
+	if err := s.Validate(r); err != nil {
+		return Revision{}, err
+	}
+	return r, nil
+}
+
+func (s revisionASME) String(r Revision) string {
+	if s.Validate(r) != nil {
+		return "<invalid revision index>"
+	}
+	return codeString(r.Index[:]) + draftSuffix(r)
+}
+
+func (revisionASME) Validate(r Revision) error {
+	if r.Kind != RevisionASME {
+		return errRevisionKindMismatch
+	}
+	if strings.IndexByte(asmeLetters, r.Index[0]) < 0 ||
+		r.Index[1] != 0 && strings.IndexByte(asmeLetters, r.Index[1]) < 0 {
+		return errors.New("ASME revision index must be one or two upper case letters excluding I, O, Q, S, X and Z")
+	}
+	return nil
+}
+
+func (revisionASME) IncrementMinor(r Revision, isRelease bool) (Revision, error) {
+	return Revision{}, errNoMinorIndex
+}
+
+func (s revisionASME) IncrementMajor(r Revision, isRelease bool) (Revision, error) {
+	if err := s.Validate(r); err != nil {
+		return Revision{}, err
+	}
+	last := asmeLetters[len(asmeLetters)-1]
+	switch {
+	case r.Index[1] == 0 && r.Index[0] == last:
+		r.Index = [2]byte{asmeLetters[0], asmeLetters[0]}
+	case r.Index[1] == 0:
+		r.Index[0] = asmeNext(r.Index[0])
+	case r.Index[1] != last:
+		r.Index[1] = asmeNext(r.Index[1])
+	case r.Index[0] != last:
+		r.Index = [2]byte{asmeNext(r.Index[0]), asmeLetters[0]}
+	default:
+		return Revision{}, errors.New("revision major index overflow")
+	}
+	r.IsRelease = isRelease
+	return r, nil
+}
+
+func (s revisionASME) AreSequential(a, b Revision) (minor, major bool) {
+	return singleIndexSequential(s, a, b)
+}
+
+func (revisionASME) Compare(a, b Revision) int {
+	return compareIndex(a, b)
+}
+
+// asmeNext returns the ASME letter following c. c must not be the last letter.
+func asmeNext(c byte) byte {
+	return asmeLetters[strings.IndexByte(asmeLetters, c)+1]
+}
+
+// revisionNumeric implements a two digit numeric revision index scheme.
+type revisionNumeric struct{}
+
+func (revisionNumeric) Kind() RevisionKind { return RevisionNumeric }
+
+func (revisionNumeric) First() Revision {
+	return Revision{Index: [2]byte{'0', '1'}, Kind: RevisionNumeric}
+}
+
+func (s revisionNumeric) ParseRevision(revision string) (Revision, error) {
+	index, isRelease := cutDraft(revision)
+	if len(index) != 2 {
+		return Revision{}, errors.New("numeric revision index must be two digits")
+	}
+	r := Revision{Index: [2]byte{index[0], index[1]}, IsRelease: isRelease, Kind: RevisionNumeric}
+	if err := s.Validate(r); err != nil {
+		return Revision{}, err
+	}
+	return r, nil
+}
+
+func (s revisionNumeric) String(r Revision) string {
+	if s.Validate(r) != nil {
+		return "<invalid revision index>"
+	}
+	return string(r.Index[:]) + draftSuffix(r)
+}
+
+func (revisionNumeric) Validate(r Revision) error {
+	if r.Kind != RevisionNumeric {
+		return errRevisionKindMismatch
+	}
+	if !isNum(r.Index[0]) || !isNum(r.Index[1]) {
+		return errors.New("numeric revision index must be two digits")
+	}
+	return nil
+}
+
+func (revisionNumeric) IncrementMinor(r Revision, isRelease bool) (Revision, error) {
+	return Revision{}, errNoMinorIndex
+}
+
+func (s revisionNumeric) IncrementMajor(r Revision, isRelease bool) (Revision, error) {
+	if err := s.Validate(r); err != nil {
+		return Revision{}, err
+	}
+	switch {
+	case r.Index == [2]byte{'9', '9'}:
+		return Revision{}, errors.New("revision index overflow")
+	case r.Index[1] == '9':
+		r.Index = [2]byte{r.Index[0] + 1, '0'}
+	default:
+		r.Index[1]++
+	}
+	r.IsRelease = isRelease
+	return r, nil
+}
+
+func (s revisionNumeric) AreSequential(a, b Revision) (minor, major bool) {
+	return singleIndexSequential(s, a, b)
+}
+
+func (revisionNumeric) Compare(a, b Revision) int {
+	return compareIndex(a, b)
+}
@@ -0,0 +1,342 @@
+package qap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CharClass is a set of characters allowed in a document code.
+type CharClass uint8
+
+const (
+	// Upper case ASCII letters A..Z.
+	Upper CharClass = 1 << iota
+	// ASCII digits 0..9.
+	Digits
+)
+
+// Contains returns true if char belongs to the character class.
+func (c CharClass) Contains(char byte) bool {
+	return c&Upper != 0 && isAlpha(char) || c&Digits != 0 && isNum(char)
+}
+
+// String returns a human readable description of the character class
+// i.e. "upper case" or "digits or/and upper case".
+func (c CharClass) String() string {
+	switch c {
+	case Upper:
+		return "upper case"
+	case Digits:
+		return "digit"
+	case Upper | Digits:
+		return "digits or/and upper case"
+	}
+	return "<invalid character class>"
+}
+
+func (c CharClass) valid() bool {
+	return c != 0 && c&^(Upper|Digits) == 0
+}
+
+func (c CharClass) match(b []byte) bool {
+	for _, char := range b {
+		if !c.Contains(char) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scheme parametrizes the document naming convention. It defines the length
+// and allowed characters of each document code along with the range and
+// formatting width of document and attachment numbers.
+//
+// Header's code fields limit the maximum length of the codes a Scheme can
+// define: project codes may be up to 4 characters, equipment codes up to 5
+// characters and document type codes up to 3 characters.
+//
+// Only Scheme's own methods follow the scheme. Header's methods, HeaderCodesEqual,
+// HeadersEqual and HeaderFilter always validate headers against QAP202, so headers of
+// other schemes can not be stored in a HeaderFilter nor marshalled as text.
+type Scheme struct {
+	// Exact length of the project code.
+	ProjectLen   int
+	ProjectChars CharClass
+	// Equipment code length is in range EquipmentMinLen..EquipmentMaxLen.
+	EquipmentMinLen int
+	EquipmentMaxLen int
+	EquipmentChars  CharClass
+	// Exact length of the document type code.
+	DocumentTypeLen   int
+	DocumentTypeChars CharClass
+	// Numbers below 10^NumberDigits-1 are formatted with NumberDigits digits,
+	// the remaining numbers are formatted with NumberMaxDigits digits.
+	NumberDigits    int
+	NumberMaxDigits int
+	MaxNumber       int32
+	// Attachment numbers are formatted with AttachmentDigits digits.
+	AttachmentDigits int
+	MaxAttachment    uint8
+}
+
+// qap202 is the naming scheme defined by LHC-PM-QA-202. It is the scheme
+// used by Header's methods and by the package level parsing functions. It is
+// unexported so that it can not be changed after being checked in init.
+var qap202 = Scheme{
+	ProjectLen:        lenP,
+	ProjectChars:      Upper,
+	EquipmentMinLen:   1,
+	EquipmentMaxLen:   lenE,
+	EquipmentChars:    Upper | Digits,
+	DocumentTypeLen:   lenDT,
+	DocumentTypeChars: Upper,
+	NumberDigits:      3,
+	NumberMaxDigits:   6,
+	MaxNumber:         maxDocumentNumber,
+	AttachmentDigits:  2,
+	MaxAttachment:     maxAttachmentNumber,
+}
+
+// QAP202 returns the naming scheme defined by LHC-PM-QA-202. Changes to
+// the returned Scheme do not affect Header's methods.
+func QAP202() Scheme { return qap202 }
+
+func init() {
+	if err := qap202.checkParams(); err != nil {
+		panic(err)
+	}
+}
+
+// maxLength returns the maximum length of a document name
+// string including code separators.
+func (s Scheme) maxLength() int {
+	return s.ProjectLen + s.EquipmentMaxLen + s.DocumentTypeLen + s.NumberMaxDigits + s.AttachmentDigits + 4
+}
+
+// check tests the scheme parameters are consistent.
+func (s Scheme) check() error {
+	if s == qap202 {
+		return nil // Checked in init.
+	}
+	return s.checkParams()
+}
+
+func (s Scheme) checkParams() error {
+	switch {
+	case s.ProjectLen < 1 || s.ProjectLen > capP:
+		return fmt.Errorf("scheme project code length must be in range 1..%d", capP)
+	case s.EquipmentMinLen < 1 || s.EquipmentMaxLen < s.EquipmentMinLen || s.EquipmentMaxLen > capE:
+		return fmt.Errorf("scheme equipment code length must be in range 1..%d", capE)
+	case s.DocumentTypeLen < 1 || s.DocumentTypeLen > capDT:
+		return fmt.Errorf("scheme document type code length must be in range 1..%d", capDT)
+	case !s.ProjectChars.valid() || !s.EquipmentChars.valid() || !s.DocumentTypeChars.valid():
+		return errors.New("scheme has invalid character class")
+	case s.NumberDigits < 1 || s.NumberMaxDigits < s.NumberDigits || s.NumberMaxDigits > 9:
+		return errors.New("scheme number digits must be in range 1..9")
+	case s.MaxNumber < 0 || int64(s.MaxNumber) >= pow10(s.NumberMaxDigits):
+		return errors.New("scheme maximum number does not fit in number digits")
+	case s.AttachmentDigits < 1 || s.AttachmentDigits > 3 || int64(s.MaxAttachment) >= pow10(s.AttachmentDigits):
+		return errors.New("scheme maximum attachment number does not fit in attachment digits")
+	}
+	return nil
+}
+
+// Validate tests Header for malformed data according to the scheme.
+func (s Scheme) Validate(h Header) (err error) {
+	if err := s.check(); err != nil {
+		return err
+	}
+	proj := h.ProjectCode[:idxOfNullOrLen(h.ProjectCode[:])]
+	equip := h.EquipmentCode[:idxOfNullOrLen(h.EquipmentCode[:])]
+	doctype := h.DocumentTypeCode[:idxOfNullOrLen(h.DocumentTypeCode[:])]
+	switch {
+	case h.AttachmentNumber > s.MaxAttachment:
+		err = s.errBadAttachmentNumber()
+	case !isZeroPadded(h.ProjectCode[:]):
+		err = s.errBadProjectCode()
+	case !isZeroPadded(h.EquipmentCode[:]):
+		err = s.errBadEquipmentCode()
+	case !isZeroPadded(h.DocumentTypeCode[:]):
+		err = s.errBadDocumentTypeCode()
+	case !s.ProjectChars.match(proj):
+		err = s.errBadProjectCode()
+	case !s.EquipmentChars.match(equip):
+		err = s.errBadEquipmentCode()
+	case !s.DocumentTypeChars.match(doctype):
+		err = s.errBadDocumentTypeCode()
+	case h.Number < minDocumentNumber || h.Number > s.MaxNumber:
+		err = s.errInvalidNumber()
+	case len(proj) == 0:
+		err = ErrEmptyProjectCode
+	case len(equip) == 0:
+		err = ErrEmptyEquipmentCode
+	case len(doctype) == 0:
+		err = ErrEmptyDocumentTypeCode
+	}
+	if err != nil {
+		return err
+	}
+	// Length errors
+	switch {
+	case len(proj) != s.ProjectLen:
+		err = s.errBadProjectCode()
+	case len(equip) < s.EquipmentMinLen || len(equip) > s.EquipmentMaxLen:
+		err = s.errBadEquipmentCode()
+	case len(doctype) != s.DocumentTypeLen:
+		err = s.errBadDocumentTypeCode()
+	}
+	return err
+}
+
+// Format returns the Header's document name representation according to the
+// scheme i.e. "SPS-PEC-HP-023.00". If the header is not valid within the
+// scheme a constant string is returned.
+func (s Scheme) Format(h Header) string {
+	if s.Validate(h) != nil {
+		return "<invalid header>"
+	}
+	width := s.NumberMaxDigits
+	if int64(h.Number) < pow10(s.NumberDigits)-1 {
+		width = s.NumberDigits
+	}
+	return fmt.Sprintf("%s-%s-%s-%0*d.%0*d", codeString(h.ProjectCode[:]), codeString(h.EquipmentCode[:]),
+		codeString(h.DocumentTypeCode[:]), width, h.Number, s.AttachmentDigits, h.AttachmentNumber)
+}
+
+// ParseHeader parses a complete unversioned document string of the style
+// "SPS-PEC-HP-0023.01" according to the scheme. The attachment number parsing
+// may be omitted by setting ignoreAttachment to true setting attachment result to 0.
+func (s Scheme) ParseHeader(header string, ignoreAttachment bool) (Header, error) {
+	h := Header{}
+	if err := s.check(); err != nil {
+		return h, err
+	}
+	if len(header) > s.maxLength() {
+		// Prevent long string attack.
+		return h, errors.New("document name longer than maximum possible length")
+	}
+	splits := strings.SplitN(header, "-", 4)
+	if len(splits) < 4 {
+		return h, fmt.Errorf("expected document name to be split in 4 substrings at \"-\" characters. got %d", len(splits))
+	}
+	switch {
+	case len(splits[0]) == 0:
+		return h, ErrEmptyProjectCode
+	case len(splits[1]) == 0:
+		return h, ErrEmptyEquipmentCode
+	case len(splits[2]) == 0:
+		return h, ErrEmptyDocumentTypeCode
+	case len(splits[0]) != s.ProjectLen:
+		return h, s.errBadProjectCode()
+	case len(splits[1]) > s.EquipmentMaxLen:
+		return h, s.errBadEquipmentCode()
+	case len(splits[2]) != s.DocumentTypeLen:
+		return h, s.errBadDocumentTypeCode()
+	}
+	var attachment uint8
+	numStr, attachStr, foundAttachment := strings.Cut(splits[3], ".")
+	if !ignoreAttachment {
+		if !foundAttachment {
+			return h, errors.New("did not find attachment number in document name following period")
+		}
+		attachNum, err := strconv.Atoi(attachStr)
+		if err != nil {
+			return h, errors.New("parsing attachment number: " + err.Error())
+		}
+		if attachNum < 0 || attachNum > int(s.MaxAttachment) {
+			return h, s.errBadAttachmentNumber()
+		}
+		attachment = uint8(attachNum)
+	}
+	num, err := strconv.Atoi(numStr)
+	if err != nil {
+		return h, errors.New("parsing document name number: " + err.Error())
+	}
+	if num < minDocumentNumber || num > int(s.MaxNumber) {
+		return h, s.errInvalidNumber()
+	}
+
+	copy(h.ProjectCode[:], splits[0])
+	copy(h.EquipmentCode[:], splits[1])
+	copy(h.DocumentTypeCode[:], splits[2])
+	h.Number = int32(num)
+	h.AttachmentNumber = attachment
+	if err := s.Validate(h); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
+
+// ParseDocumentCodes is a helper function to extract document codes from
+// human input according to the scheme.
+func (s Scheme) ParseDocumentCodes(documentName string) (project, equipment, docType string) {
+	safeLen := s.maxLength() + 5
+	if len(documentName) > safeLen {
+		documentName = documentName[:safeLen]
+	}
+	splits := strings.SplitN(strings.ToUpper(strings.TrimSpace(documentName)), "-", 4)
+	if len(splits) > 0 && len(splits[0]) == s.ProjectLen && s.ProjectChars.match([]byte(splits[0])) {
+		project = splits[0]
+	}
+	if len(splits) > 1 && 0 < len(splits[1]) && len(splits[1]) <= s.EquipmentMaxLen && s.EquipmentChars.match([]byte(splits[1])) {
+		equipment = splits[1]
+	}
+	if len(splits) > 2 && len(splits[2]) == s.DocumentTypeLen && s.DocumentTypeChars.match([]byte(splits[2])) {
+		docType = splits[2]
+	}
+	return project, equipment, docType
+}
+
+func (s Scheme) errInvalidNumber() error {
+	return schemeErr(ErrInvalidNumber, fmt.Sprintf("QAP number out of range 0..%d", s.MaxNumber))
+}
+
+func (s Scheme) errBadProjectCode() error {
+	return schemeErr(ErrBadProjectCode, fmt.Sprintf("project code must be %d %s characters", s.ProjectLen, s.ProjectChars))
+}
+
+func (s Scheme) errBadEquipmentCode() error {
+	return schemeErr(ErrBadEquipmentCode, fmt.Sprintf("equipment code must be %d..%d %s characters", s.EquipmentMinLen, s.EquipmentMaxLen, s.EquipmentChars))
+}
+
+func (s Scheme) errBadDocumentTypeCode() error {
+	return schemeErr(ErrBadDocumentTypeCode, fmt.Sprintf("document type code must be %d %s characters", s.DocumentTypeLen, s.DocumentTypeChars))
+}
+
+func (s Scheme) errBadAttachmentNumber() error {
+	return schemeErr(ErrBadAttachmentNumber, fmt.Sprintf("attachment number must be %d digits in range 0..%d", s.AttachmentDigits, s.MaxAttachment))
+}
+
+// schemeError is a scheme specific error message wrapping
+// one of the package's sentinel errors.
+type schemeError struct {
+	err error
+	msg string
+}
+
+func (e *schemeError) Error() string { return e.msg }
+func (e *schemeError) Unwrap() error { return e.err }
+
+// schemeErr returns sentinel if msg is the sentinel's message, which is
+// the case for the QAP202 scheme. Otherwise it returns msg wrapping sentinel.
+func schemeErr(sentinel error, msg string) error {
+	if sentinel.Error() == msg {
+		return sentinel
+	}
+	return &schemeError{err: sentinel, msg: msg}
+}
+
+// codeString returns the code stored in b up to the first null character.
+func codeString(b []byte) string {
+	return string(b[:idxOfNullOrLen(b)])
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
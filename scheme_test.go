@@ -0,0 +1,93 @@
+package qap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchemeParseHeader(t *testing.T) {
+	sister := QAP202()
+	sister.ProjectLen = 4
+	sister.DocumentTypeLen = 3
+	for _, test := range []struct {
+		Scheme Scheme
+		Input  string
+		Expect Header
+	}{
+		{
+			Scheme: QAP202(),
+			Input:  "SPS-PEC-HP-001.00",
+			Expect: Header{
+				ProjectCode:      [4]byte{'S', 'P', 'S'},
+				EquipmentCode:    [5]byte{'P', 'E', 'C'},
+				DocumentTypeCode: [3]byte{'H', 'P'},
+				Number:           1,
+			},
+		},
+		{
+			Scheme: sister,
+			Input:  "ACME-PEC1-DRW-001000.03",
+			Expect: Header{
+				ProjectCode:      [4]byte{'A', 'C', 'M', 'E'},
+				EquipmentCode:    [5]byte{'P', 'E', 'C', '1'},
+				DocumentTypeCode: [3]byte{'D', 'R', 'W'},
+				Number:           1000,
+				AttachmentNumber: 3,
+			},
+		},
+	} {
+		h, err := test.Scheme.ParseHeader(test.Input, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != test.Expect {
+			t.Errorf("expected result %v from %q got %v", test.Expect, test.Input, h)
+		}
+		if got := test.Scheme.Format(h); got != test.Input {
+			t.Errorf("expected Format %q to be equal to input %q", got, test.Input)
+		}
+	}
+}
+
+func TestSchemeValidate(t *testing.T) {
+	sister := QAP202()
+	sister.ProjectLen = 4
+	sister.DocumentTypeLen = 3
+	hd, err := sister.ParseHeader("ACME-PEC-DRW-001.00", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hd.Validate(); !errors.Is(err, ErrBadProjectCode) {
+		t.Errorf("expected QAP202 to reject 4 letter project code, got %v", err)
+	}
+	if hd.String() != "<invalid header>" {
+		t.Errorf("expected invalid QAP202 header string, got %q", hd)
+	}
+	_, err = sister.ParseHeader("LHC-PEC-DRW-001.00", false)
+	if !errors.Is(err, ErrBadProjectCode) {
+		t.Errorf("expected ErrBadProjectCode, got %v", err)
+	}
+	if err.Error() == ErrBadProjectCode.Error() {
+		t.Errorf("expected scheme specific error message, got %q", err)
+	}
+	_, err = QAP202().ParseHeader("LH-PEC-DR-001.00", false)
+	if err != ErrBadProjectCode {
+		t.Errorf("expected QAP202 to return sentinel error, got %v", err)
+	}
+	bad := QAP202()
+	bad.EquipmentMaxLen = 8
+	if _, err := bad.ParseHeader("LHC-PEC-DR-001.00", false); err == nil {
+		t.Error("expected error for scheme with equipment codes that do not fit in Header")
+	}
+}
+
+func TestQAP202Immutable(t *testing.T) {
+	s := QAP202()
+	s.ProjectLen = 4
+	if _, err := ParseHeader("LHC-PEC-DR-001.00", false); err != nil {
+		t.Errorf("changing a copy of QAP202 changed parsing: %s", err)
+	}
+	if QAP202() == s {
+		t.Error("QAP202 returned the changed scheme")
+	}
+}
@@ -0,0 +1,233 @@
+package qap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SerialRange is a range of numbered equipment under a node of a project
+// structure, such as the 2-digit serials "MVR01" to "MVR50" of type "MVR".
+// The serial digits take up the levels following the Prefix node.
+type SerialRange struct {
+	// Prefix is the equipment code of the node the serials are numbered under.
+	Prefix string
+	// Digits is the amount of digits of the serial numbers.
+	Digits int
+	// Min and Max are the inclusive bounds of the serial numbers.
+	Min, Max    int
+	Name        string
+	Description string `json:",omitempty"`
+}
+
+// ParseSerialRange parses a serial range pattern. A pattern is the prefix
+// equipment code followed by either a "#" per digit, which allows any serial
+// with that amount of digits, or a bracketed inclusive range whose bounds
+// have the same amount of digits:
+//
+//	MVR##       MVR00 to MVR99
+//	MVR[01-50]  MVR01 to MVR50
+func ParseSerialRange(pattern string) (SerialRange, error) {
+	errBad := fmt.Errorf("bad serial range %q, must be of the form MVR## or MVR[01-50]", pattern)
+	var sr SerialRange
+	if i := strings.IndexByte(pattern, '#'); i >= 0 {
+		sr.Prefix, sr.Digits = pattern[:i], len(pattern)-i
+		if strings.Trim(pattern[i:], "#") != "" {
+			return SerialRange{}, errBad
+		}
+		sr.Max = int(pow10(sr.Digits)) - 1
+	} else {
+		i := strings.IndexByte(pattern, '[')
+		lo, hi, ok := strings.Cut(strings.TrimSuffix(pattern[i+1:], "]"), "-")
+		if i < 0 || !strings.HasSuffix(pattern, "]") || !ok || len(lo) != len(hi) || !isDigits(lo) || !isDigits(hi) {
+			return SerialRange{}, errBad
+		}
+		sr.Prefix, sr.Digits = pattern[:i], len(lo)
+		sr.Min, _ = strconv.Atoi(lo)
+		sr.Max, _ = strconv.Atoi(hi)
+	}
+	return sr, sr.Validate()
+}
+
+// Validate tests the serial range for malformed data.
+func (sr SerialRange) Validate() error {
+	switch {
+	case len(sr.Prefix) == 0 || validQAPAlphanum([]byte(sr.Prefix)) != sr.Prefix:
+		return ErrBadEquipmentCode
+	case sr.Digits < 1 || len(sr.Prefix)+sr.Digits > lenE:
+		return fmt.Errorf("serial range under %s may have 1 to %d digits", sr.Prefix, lenE-len(sr.Prefix))
+	case sr.Min < 0 || sr.Max < sr.Min || sr.Max >= int(pow10(sr.Digits)):
+		return fmt.Errorf("bad serial range bounds %d..%d for %d digits", sr.Min, sr.Max, sr.Digits)
+	}
+	return nil
+}
+
+// Pattern returns the serial range pattern as parsed by ParseSerialRange.
+func (sr SerialRange) Pattern() string {
+	if sr.Min == 0 && sr.Max == int(pow10(sr.Digits))-1 {
+		return sr.Prefix + strings.Repeat("#", sr.Digits)
+	}
+	return fmt.Sprintf("%s[%0*d-%0*d]", sr.Prefix, sr.Digits, sr.Min, sr.Digits, sr.Max)
+}
+
+func (sr SerialRange) String() string {
+	if sr.Name == "" {
+		return sr.Pattern()
+	}
+	return sr.Pattern() + " " + sr.Name
+}
+
+// Contains reports whether code is an equipment code of the serial range.
+func (sr SerialRange) Contains(code string) bool {
+	if len(code) != len(sr.Prefix)+sr.Digits || !strings.HasPrefix(code, sr.Prefix) {
+		return false
+	}
+	serial := code[len(sr.Prefix):]
+	if !isDigits(serial) {
+		return false
+	}
+	n, _ := strconv.Atoi(serial)
+	return sr.Min <= n && n <= sr.Max
+}
+
+// overlaps reports whether sr and other have equipment codes in common.
+func (sr SerialRange) overlaps(other SerialRange) bool {
+	return sr.Prefix == other.Prefix && sr.Digits == other.Digits && sr.Min <= other.Max && other.Min <= sr.Max
+}
+
+// claims reports whether the range contains equipment codes starting with
+// code, which are the codes of a node and its children, i.e. "MVR##" claims
+// the codes of model "MVR0" whose variants would be serials of the range.
+func (sr SerialRange) claims(code string) bool {
+	if len(code) <= len(sr.Prefix) || len(code) > len(sr.Prefix)+sr.Digits || !strings.HasPrefix(code, sr.Prefix) {
+		return false
+	}
+	lead := code[len(sr.Prefix):]
+	if !isDigits(lead) {
+		return false
+	}
+	n, _ := strconv.Atoi(lead)
+	scale := int(pow10(sr.Digits - len(lead)))
+	return n*scale <= sr.Max && sr.Min <= n*scale+scale-1
+}
+
+// AddSerialRange adds a range of numbered equipment under the existing node
+// sr.Prefix. The range may not overlap with existing ranges nor claim the
+// codes of existing nodes, see AddEquipmentCode.
+func (p *Project) AddSerialRange(sr SerialRange) error {
+	if err := sr.Validate(); err != nil {
+		return err
+	}
+	if _, err := p.node(sr.Prefix); err != nil {
+		return err
+	}
+	for _, existing := range p.Serials {
+		if existing.overlaps(sr) {
+			return fmt.Errorf("serial range %s overlaps with %s", sr.Pattern(), existing.Pattern())
+		}
+	}
+	err := p.Walk(func(n Node) error {
+		if sr.claims(n.Code) {
+			return fmt.Errorf("serial range %s overlaps with equipment code %s", sr.Pattern(), n.Code)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.Serials = append(p.Serials, sr)
+	return nil
+}
+
+// checkSerials returns an error if a node with the equipment
+// code would claim codes of one of the project's serial ranges.
+func (p Project) checkSerials(code string) error {
+	for _, sr := range p.Serials {
+		if sr.claims(code) {
+			return fmt.Errorf("equipment code %s overlaps with serial range %s", code, sr.Pattern())
+		}
+	}
+	return nil
+}
+
+// rekeySerials replaces the equipment code prefix from with to in the serial
+// ranges under the node from so that ranges follow their node when it is
+// recoded or moved. If to is empty the ranges are removed.
+func (p *Project) rekeySerials(from, to string) {
+	var serials []SerialRange
+	for _, sr := range p.Serials {
+		if strings.HasPrefix(sr.Prefix, from) {
+			if to == "" {
+				continue
+			}
+			sr.Prefix = to + sr.Prefix[len(from):]
+		}
+		serials = append(serials, sr)
+	}
+	p.Serials = serials
+}
+
+// checkRekeySerials returns an error if the node from and its children would
+// claim codes of serial ranges not under from once recoded or moved to to.
+func (p Project) checkRekeySerials(from, to string) error {
+	return p.Walk(func(n Node) error {
+		if !strings.HasPrefix(n.Code, from) {
+			return nil
+		}
+		code := to + n.Code[len(from):]
+		for _, sr := range p.Serials {
+			if !strings.HasPrefix(sr.Prefix, from) && sr.claims(code) {
+				return fmt.Errorf("equipment code %s overlaps with serial range %s", code, sr.Pattern())
+			}
+		}
+		return nil
+	})
+}
+
+// serialRange returns the serial range containing the equipment code.
+func (p Project) serialRange(code string) (SerialRange, bool) {
+	for _, sr := range p.Serials {
+		if sr.Contains(code) {
+			return sr, true
+		}
+	}
+	return SerialRange{}, false
+}
+
+// maxSerialCompletions is the most serials of a range listed by Project.Complete.
+const maxSerialCompletions = 100
+
+// completions returns the nodes of the serials of the range named as by
+// Project.Resolve, or a single node with the range pattern as its code
+// if the range has more than maxSerialCompletions serials.
+func (sr SerialRange) completions() []Node {
+	level := NodeLevel(len(sr.Prefix) + sr.Digits)
+	if sr.Max-sr.Min >= maxSerialCompletions {
+		return []Node{{Level: level, Code: sr.Pattern(), Name: sr.Name, Description: sr.Description}}
+	}
+	nodes := make([]Node, 0, sr.Max-sr.Min+1)
+	for n := sr.Min; n <= sr.Max; n++ {
+		serial := fmt.Sprintf("%0*d", sr.Digits, n)
+		nodes = append(nodes, Node{
+			Level:       level,
+			Code:        sr.Prefix + serial,
+			Name:        strings.TrimSpace(sr.Name + " " + serial),
+			Description: sr.Description,
+		})
+	}
+	return nodes
+}
+
+// isSerialPattern reports whether code is a serial range pattern instead of an equipment code.
+func isSerialPattern(code string) bool {
+	return strings.ContainsAny(code, "#[")
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isNum(s[i]) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
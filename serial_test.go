@@ -0,0 +1,145 @@
+package qap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSerialRange(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		want    SerialRange
+		err     bool
+	}{
+		{pattern: "MVR##", want: SerialRange{Prefix: "MVR", Digits: 2, Min: 0, Max: 99}},
+		{pattern: "MVR[01-50]", want: SerialRange{Prefix: "MVR", Digits: 2, Min: 1, Max: 50}},
+		{pattern: "M1[001-120]", want: SerialRange{Prefix: "M1", Digits: 3, Min: 1, Max: 120}},
+		{pattern: "M####", want: SerialRange{Prefix: "M", Digits: 4, Min: 0, Max: 9999}},
+		{pattern: "##", err: true},
+		{pattern: "MVR###", err: true},
+		{pattern: "MV#R#", err: true},
+		{pattern: "MVR[1-50]", err: true},
+		{pattern: "MVR[50-01]", err: true},
+		{pattern: "MVR[01-5A]", err: true},
+		{pattern: "MVR[01-50", err: true},
+		{pattern: "mvr##", err: true},
+	} {
+		got, err := ParseSerialRange(test.pattern)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error %v", test.pattern, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %+v, want %+v", test.pattern, got, test.want)
+		}
+		if got.Pattern() != test.pattern {
+			t.Errorf("%q: pattern round trip got %q", test.pattern, got.Pattern())
+		}
+	}
+}
+
+func TestProjectAlphanumericCodes(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MVR[01-50]", "MVRA", "MVRA#", "M2", "M2A", "M2A7"} {
+		if err := p.AddEquipmentCode(code, "Unit", "desc"); err != nil {
+			t.Fatalf("adding %q: %s", code, err)
+		}
+	}
+	for _, code := range []string{"MVR[40-60]", "MVZ##", "MVR[01-50]", "MVRA##", "M2a"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err == nil {
+			t.Errorf("expected error adding %q", code)
+		}
+	}
+	for code, expect := range map[string]bool{
+		"MVR01": true, "MVR50": true, "MVRA0": true, "MVRA9": true, "M2A7": true, "M2A": true,
+		"MVR00": false, "MVR51": false, "MVR1": false, "MVRB0": false, "M2A8": false, "MVR0A": false,
+	} {
+		hd, err := ParseHeader("LHC-"+code+"-DR-001.00", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ContainsCode(hd) != expect {
+			t.Errorf("expected ContainsCode(%s) == %t", hd, expect)
+		}
+	}
+	nodes, err := p.Resolve("MVR07")
+	if err != nil || NodePath(nodes) != "Unit > Unit > Unit > Unit 07" || nodes[3].Level != LevelVariant {
+		t.Errorf("unexpected serial resolution %v %v", nodes, err)
+	}
+	if _, err := p.Resolve("MVR51"); err == nil {
+		t.Error("expected error resolving code outside of serial range")
+	}
+
+	// Serial ranges follow edits of the node they are numbered under.
+	edited := p.clone()
+	if _, err := edited.RecodeNode(nil, "MV", 'W'); err != nil {
+		t.Fatal(err)
+	}
+	var patterns []string
+	for _, sr := range edited.Serials {
+		patterns = append(patterns, sr.Pattern())
+	}
+	if !reflect.DeepEqual(patterns, []string{"MWR[01-50]", "MWRA#"}) {
+		t.Errorf("unexpected serial ranges after recode %v", patterns)
+	}
+	if _, err := edited.DeleteNode(nil, "MWRA"); err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.Serials) != 1 || len(p.Serials) != 2 {
+		t.Errorf("unexpected serial ranges after delete %v, original %v", edited.Serials, p.Serials)
+	}
+
+	// Serial ranges are exported and imported with breakdown files.
+	imported := Project{Code: p.Code}
+	if issues := imported.ImportBreakdown(p.Breakdown()); len(issues) != 0 {
+		t.Fatal(issues)
+	}
+	if !reflect.DeepEqual(imported.Serials, p.Serials) {
+		t.Errorf("serial ranges lost in breakdown round trip: %v", imported.Serials)
+	}
+	if changes := DiffProjects(edited, p); len(changes) == 0 {
+		t.Error("expected serial range differences")
+	}
+}
+
+func TestSerialRangeNodeOverlap(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MVR[01-50]", "MVR6", "MVRA", "MB", "MBR", "MBR0"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatalf("adding %q: %s", code, err)
+		}
+	}
+	// Nodes may not claim codes of a serial range.
+	for _, code := range []string{"MVR0", "MVR5", "MVR1"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err == nil {
+			t.Errorf("expected error adding %q inside serial range MVR[01-50]", code)
+		}
+	}
+	// Serial ranges may not claim codes of existing nodes.
+	for _, pattern := range []string{"MVR[55-69]", "MBR##", "MBR[00-09]"} {
+		if err := p.AddEquipmentCode(pattern, "name", "desc"); err == nil {
+			t.Errorf("expected error adding serial range %q over existing node", pattern)
+		}
+	}
+	for _, pattern := range []string{"MVR[70-99]", "MBR[10-99]"} {
+		if err := p.AddEquipmentCode(pattern, "name", "desc"); err != nil {
+			t.Errorf("adding %q: %s", pattern, err)
+		}
+	}
+	// Nodes may not be recoded or moved into serial ranges.
+	if err := p.AddEquipmentCode("MVRA1", "name", "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RecodeNode(nil, "MVRA", '0'); err == nil {
+		t.Error("expected error recoding model into serial range")
+	}
+	if _, err := p.MoveNode(nil, "MBR0", "MVR"); err == nil {
+		t.Error("expected error moving model into serial range")
+	}
+	if _, err := p.RecodeNode(nil, "MVRA", 'B'); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,152 @@
+package qap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// State is the lifecycle state of a document revision. The zero value is
+// an unspecified state, in which case the state is derived from the release
+// status of the revision. See StateOf.
+//
+// Allowed transitions between states are:
+//
+//	In Work        -> Under Approval, Cancelled
+//	Under Approval -> In Work, Released, Cancelled
+//	Released       -> Obsolete
+//
+// Obsolete and Cancelled are final states.
+type State uint8
+
+const (
+	// StateInWork revisions are drafts being worked on.
+	StateInWork State = iota + 1
+	// StateUnderApproval revisions are drafts submitted for approval.
+	StateUnderApproval
+	// StateReleased revisions have been approved and released.
+	StateReleased
+	// StateObsolete revisions were released and have been superseded or withdrawn.
+	StateObsolete
+	// StateCancelled revisions were abandoned before being released.
+	StateCancelled
+)
+
+var errBadState = errors.New("unknown lifecycle state")
+
+// transitions maps each state to the states it may transition to.
+var transitions = [...][]State{
+	StateInWork:        {StateUnderApproval, StateCancelled},
+	StateUnderApproval: {StateInWork, StateReleased, StateCancelled},
+	StateReleased:      {StateObsolete},
+	StateObsolete:      nil,
+	StateCancelled:     nil,
+}
+
+// StateOf returns the lifecycle state implied by the release status of a revision
+// with no explicit state: released revisions are Released and drafts are In Work.
+func StateOf(r Revision) State {
+	if r.IsRelease {
+		return StateReleased
+	}
+	return StateInWork
+}
+
+// ParseState returns the state corresponding to the name returned by
+// State.String. Case and spaces are ignored, so "under approval" and
+// "UnderApproval" are both accepted.
+func ParseState(name string) (State, error) {
+	compact := strings.ReplaceAll(name, " ", "")
+	for s := StateInWork; s.Validate() == nil; s++ {
+		if strings.EqualFold(compact, strings.ReplaceAll(s.String(), " ", "")) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown lifecycle state %q", name)
+}
+
+// String returns the name of the state i.e. "In Work", "Under Approval".
+func (s State) String() string {
+	switch s {
+	case StateInWork:
+		return "In Work"
+	case StateUnderApproval:
+		return "Under Approval"
+	case StateReleased:
+		return "Released"
+	case StateObsolete:
+		return "Obsolete"
+	case StateCancelled:
+		return "Cancelled"
+	}
+	return "<invalid state>"
+}
+
+// Validate tests the state is a known lifecycle state.
+func (s State) Validate() error {
+	if s < StateInWork || s > StateCancelled {
+		return errBadState
+	}
+	return nil
+}
+
+// IsRelease reports whether revisions in the state are releases.
+func (s State) IsRelease() bool {
+	return s == StateReleased || s == StateObsolete
+}
+
+// IsFinal reports whether the state has no transitions to other states.
+func (s State) IsFinal() bool {
+	return s.Validate() == nil && len(transitions[s]) == 0
+}
+
+// Transitions returns the states s may transition to.
+func (s State) Transitions() []State {
+	if s.Validate() != nil {
+		return nil
+	}
+	return append([]State(nil), transitions[s]...)
+}
+
+// CanTransition reports whether s may transition to the state to.
+func (s State) CanTransition(to State) bool {
+	if s.Validate() != nil {
+		return false
+	}
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition returns the state to if s is allowed to transition to it
+// and an error otherwise.
+func (s State) Transition(to State) (State, error) {
+	if err := to.Validate(); err != nil {
+		return s, err
+	}
+	if !s.CanTransition(to) {
+		return s, fmt.Errorf("lifecycle state %s can not transition to %s", s, to)
+	}
+	return to, nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s State) MarshalText() ([]byte, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *State) UnmarshalText(text []byte) error {
+	state, err := ParseState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
@@ -0,0 +1,80 @@
+package qap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateTransitions(t *testing.T) {
+	for _, test := range []struct {
+		From, To State
+		Allowed  bool
+	}{
+		{From: StateInWork, To: StateUnderApproval, Allowed: true},
+		{From: StateInWork, To: StateCancelled, Allowed: true},
+		{From: StateInWork, To: StateReleased},
+		{From: StateUnderApproval, To: StateReleased, Allowed: true},
+		{From: StateUnderApproval, To: StateInWork, Allowed: true},
+		{From: StateReleased, To: StateObsolete, Allowed: true},
+		{From: StateReleased, To: StateInWork},
+		{From: StateObsolete, To: StateReleased},
+		{From: StateCancelled, To: StateInWork},
+		{From: 0, To: StateInWork},
+		{From: StateInWork, To: 0},
+	} {
+		got, err := test.From.Transition(test.To)
+		if test.Allowed && (err != nil || got != test.To) {
+			t.Errorf("expected %s -> %s to be allowed: %v", test.From, test.To, err)
+		} else if !test.Allowed && err == nil {
+			t.Errorf("expected %s -> %s to be disallowed", test.From, test.To)
+		}
+	}
+	for s := StateInWork; s.Validate() == nil; s++ {
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got State
+		if err := got.UnmarshalText(text); err != nil || got != s {
+			t.Errorf("text round trip of %s: got %s, %v", s, got, err)
+		}
+	}
+	if s, err := ParseState("underapproval"); err != nil || s != StateUnderApproval {
+		t.Errorf("expected to parse under approval state, got %s, %v", s, err)
+	}
+}
+
+func TestDocInfoTransition(t *testing.T) {
+	hd, rev, err := ParseDocumentName("LHC-PM-QA-202.00 rev A.2-draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	info := DocInfo{Header: hd, Revision: rev, Creation: now, RevisionTime: now}
+	if info.LifecycleState() != StateInWork {
+		t.Fatalf("expected draft to be in work, got %s", info.LifecycleState())
+	}
+	for _, to := range []State{StateUnderApproval, StateReleased, StateObsolete} {
+		info, err = info.Transition(to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := info.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !info.Revision.IsRelease || info.Revision.String() != "A.2" {
+		t.Errorf("expected obsolete revision to be release A.2, got %s", info.Revision)
+	}
+	if _, err := info.Transition(StateInWork); err == nil {
+		t.Error("expected error transitioning obsolete revision")
+	}
+	info.State = StateInWork
+	if err := info.Validate(); err == nil {
+		t.Error("expected error validating released revision in work")
+	}
+	first := DocInfo{Header: hd, Revision: NewRevision(), State: StateUnderApproval, Creation: now, RevisionTime: now}
+	if _, err := first.Transition(StateReleased); err == nil {
+		t.Error("expected error releasing A.1 revision")
+	}
+}
@@ -13,10 +13,23 @@ import (
 // Project represents the overlying project structure as outlined by
 // LHC-PM-QA-202 and LHC-PM-QA-204.
 type Project struct {
-	Code        [3]byte // Project name (3 letters)
+	Code        [4]byte // Project name (3 letters)
 	Systems     []System
 	Name        string
 	Description string
+	// RevisionKind is the revision index scheme used by the project's
+	// documents. The zero value is the QAP202 revision index scheme.
+	RevisionKind RevisionKind
+	// Numbering is the policy used to allocate the numbers
+	// of new documents of the project. See NumberingPolicy.
+	Numbering NumberingPolicy
+	// DocumentTypes are the document types defined by the project in
+	// addition to the standard QAP202 document types.
+	DocumentTypes []DocumentType `json:",omitempty"`
+	// DocumentTypeRules restrict the document types allowed per system or family.
+	DocumentTypeRules []DocumentTypeRule `json:",omitempty"`
+	// Serials are the ranges of numbered equipment under nodes of the structure.
+	Serials []SerialRange `json:",omitempty"`
 }
 
 // System represents the first letter of the equipment code, which indicates
@@ -61,8 +74,22 @@ type Variant struct {
 	Description string
 }
 
+// AddEquipmentCode adds the last level of an equipment code of 1 to 5 upper case
+// letters or digits to the project structure. All preceding levels must already
+// exist, i.e. adding the model "MVRA" requires the type "MVR" to exist. Serial
+// range patterns such as "MVR##" are added with AddSerialRange, see ParseSerialRange.
 func (p *Project) AddEquipmentCode(code, name, description string) error {
-	code = validQAPAlpha([]byte(code))
+	if isSerialPattern(code) {
+		sr, err := ParseSerialRange(code)
+		if err != nil {
+			return err
+		}
+		sr.Name, sr.Description = name, description
+		return p.AddSerialRange(sr)
+	}
+	if validQAPAlphanum([]byte(code)) != code {
+		return ErrBadEquipmentCode
+	}
 	switch len(code) {
 	case 1:
 		return p.AddSystem(System{Code: code[0], Name: name, Description: description})
@@ -70,8 +97,12 @@ func (p *Project) AddEquipmentCode(code, name, description string) error {
 		return p.AddFamily(code[0], Family{Code: code[1], Name: name, Description: description})
 	case 3:
 		return p.AddType(code[0], code[1], Type{Code: code[2], Name: name, Description: description})
+	case 4:
+		return p.AddModel(code[0], code[1], code[2], Model{Code: code[3], Name: name, Description: description})
+	case 5:
+		return p.AddVariant(code[0], code[1], code[2], code[3], Variant{Code: code[4], Name: name, Description: description})
 	}
-	return errors.New("invalid code or attempted to add variant/model (not implemented)")
+	return errors.New("equipment code must be 1 to 5 letters long")
 }
 
 // Project returns the project code string. i.e. "LHC"
@@ -83,6 +114,11 @@ func (p Project) Project() string {
 	return project
 }
 
+// RevisionScheme returns the revision index scheme used by the project's documents.
+func (p Project) RevisionScheme() RevisionScheme {
+	return p.RevisionKind.Scheme()
+}
+
 func (p Project) String() string {
 	return p.Project()
 }
@@ -119,7 +155,7 @@ func (v Variant) String() string {
 }
 
 func (p *Project) AddSystem(sys System) error {
-	if !isAlpha(sys.Code) {
+	if !isAlphaNum(sys.Code) {
 		return ErrBadEquipmentCode
 	}
 	for i := range p.Systems {
@@ -133,9 +169,12 @@ func (p *Project) AddSystem(sys System) error {
 }
 
 func (p *Project) AddFamily(sys byte, family Family) error {
-	if !isAlpha(sys) || !isAlpha(family.Code) {
+	if !isAlphaNum(sys) || !isAlphaNum(family.Code) {
 		return ErrBadEquipmentCode
 	}
+	if err := p.checkSerials(string([]byte{sys, family.Code})); err != nil {
+		return err
+	}
 	for i := range p.Systems {
 		code := p.Systems[i].Code
 		if code == sys {
@@ -146,7 +185,7 @@ func (p *Project) AddFamily(sys byte, family Family) error {
 }
 
 func (s *System) AddFamily(family Family) error {
-	if !isAlpha(family.Code) {
+	if !isAlphaNum(family.Code) {
 		return ErrBadEquipmentCode
 	}
 	for i := range s.Families {
@@ -159,9 +198,12 @@ func (s *System) AddFamily(family Family) error {
 }
 
 func (p *Project) AddType(sys, family byte, tp Type) error {
-	if !isAlpha(sys) || !isAlpha(family) || !isAlpha(tp.Code) {
+	if !isAlphaNum(sys) || !isAlphaNum(family) || !isAlphaNum(tp.Code) {
 		return ErrBadEquipmentCode
 	}
+	if err := p.checkSerials(string([]byte{sys, family, tp.Code})); err != nil {
+		return err
+	}
 	for i := range p.Systems {
 		if p.Systems[i].Code == sys {
 			return p.Systems[i].AddType(family, tp)
@@ -171,7 +213,7 @@ func (p *Project) AddType(sys, family byte, tp Type) error {
 }
 
 func (s *System) AddType(family byte, tp Type) error {
-	if !isAlpha(family) || !isAlpha(tp.Code) {
+	if !isAlphaNum(family) || !isAlphaNum(tp.Code) {
 		return ErrBadEquipmentCode
 	}
 	for i := range s.Families {
@@ -183,7 +225,7 @@ func (s *System) AddType(family byte, tp Type) error {
 }
 
 func (f *Family) AddType(tp Type) error {
-	if !isAlpha(tp.Code) {
+	if !isAlphaNum(tp.Code) {
 		return ErrBadEquipmentCode
 	}
 	for i := range f.Types {
@@ -195,39 +237,156 @@ func (f *Family) AddType(tp Type) error {
 	return nil
 }
 
+func (p *Project) AddModel(sys, family, tp byte, model Model) error {
+	if !isAlphaNum(sys) || !isAlphaNum(family) || !isAlphaNum(tp) || !isAlphaNum(model.Code) {
+		return ErrBadEquipmentCode
+	}
+	if err := p.checkSerials(string([]byte{sys, family, tp, model.Code})); err != nil {
+		return err
+	}
+	for i := range p.Systems {
+		if p.Systems[i].Code == sys {
+			return p.Systems[i].AddModel(family, tp, model)
+		}
+	}
+	return fmt.Errorf("system %s not found in project %s", string(sys), p)
+}
+
+func (s *System) AddModel(family, tp byte, model Model) error {
+	if !isAlphaNum(family) || !isAlphaNum(tp) || !isAlphaNum(model.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range s.Families {
+		if s.Families[i].Code == family {
+			return s.Families[i].AddModel(tp, model)
+		}
+	}
+	return fmt.Errorf("family %s not found in system %s", string(family), s)
+}
+
+func (f *Family) AddModel(tp byte, model Model) error {
+	if !isAlphaNum(tp) || !isAlphaNum(model.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range f.Types {
+		if f.Types[i].Code == tp {
+			return f.Types[i].AddModel(model)
+		}
+	}
+	return fmt.Errorf("type %s not found in family %s", string(tp), f)
+}
+
+func (t *Type) AddModel(model Model) error {
+	if !isAlphaNum(model.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range t.Models {
+		if t.Models[i].Code == model.Code {
+			return fmt.Errorf("model %s already exists for type %s", model, t)
+		}
+	}
+	t.Models = append(t.Models, model)
+	return nil
+}
+
+func (p *Project) AddVariant(sys, family, tp, model byte, variant Variant) error {
+	if !isAlphaNum(sys) || !isAlphaNum(family) || !isAlphaNum(tp) || !isAlphaNum(model) || !isAlphaNum(variant.Code) {
+		return ErrBadEquipmentCode
+	}
+	if err := p.checkSerials(string([]byte{sys, family, tp, model, variant.Code})); err != nil {
+		return err
+	}
+	for i := range p.Systems {
+		if p.Systems[i].Code == sys {
+			return p.Systems[i].AddVariant(family, tp, model, variant)
+		}
+	}
+	return fmt.Errorf("system %s not found in project %s", string(sys), p)
+}
+
+func (s *System) AddVariant(family, tp, model byte, variant Variant) error {
+	if !isAlphaNum(family) || !isAlphaNum(tp) || !isAlphaNum(model) || !isAlphaNum(variant.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range s.Families {
+		if s.Families[i].Code == family {
+			return s.Families[i].AddVariant(tp, model, variant)
+		}
+	}
+	return fmt.Errorf("family %s not found in system %s", string(family), s)
+}
+
+func (f *Family) AddVariant(tp, model byte, variant Variant) error {
+	if !isAlphaNum(tp) || !isAlphaNum(model) || !isAlphaNum(variant.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range f.Types {
+		if f.Types[i].Code == tp {
+			return f.Types[i].AddVariant(model, variant)
+		}
+	}
+	return fmt.Errorf("type %s not found in family %s", string(tp), f)
+}
+
+func (t *Type) AddVariant(model byte, variant Variant) error {
+	if !isAlphaNum(model) || !isAlphaNum(variant.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range t.Models {
+		if t.Models[i].Code == model {
+			return t.Models[i].AddVariant(variant)
+		}
+	}
+	return fmt.Errorf("model %s not found in type %s", string(model), t)
+}
+
+func (m *Model) AddVariant(variant Variant) error {
+	if !isAlphaNum(variant.Code) {
+		return ErrBadEquipmentCode
+	}
+	for i := range m.Variants {
+		if m.Variants[i].Code == variant.Code {
+			return fmt.Errorf("variant %s already exists for model %s", variant, m)
+		}
+	}
+	m.Variants = append(m.Variants, variant)
+	return nil
+}
+
 func (s System) Letter() string {
-	if isAlpha(s.Code) {
+	if isAlphaNum(s.Code) {
 		return string(s.Code)
 	}
 	return "<invalid system code>"
 }
 func (f Family) Letter() string {
-	if isAlpha(f.Code) {
+	if isAlphaNum(f.Code) {
 		return string(f.Code)
 	}
 	return "<invalid family code>"
 }
 func (t Type) Letter() string {
-	if isAlpha(t.Code) {
+	if isAlphaNum(t.Code) {
 		return string(t.Code)
 	}
 	return "<invalid type code>"
 }
 func (m Model) Letter() string {
-	if isAlpha(m.Code) {
+	if isAlphaNum(m.Code) {
 		return string(m.Code)
 	}
 	return "<invalid model code>"
 }
 func (v Variant) Letter() string {
-	if isAlpha(v.Code) {
+	if isAlphaNum(v.Code) {
 		return string(v.Code)
 	}
 	return "<invalid variant code>"
 }
 
 // ContainsCode returns true if header equipment code and project code
-// exist inside the project structure. Does not check for validity of entire Header.
+// exist inside the project structure, either as a node or as a code of a
+// serial range. Does not check for validity of entire Header.
 func (p Project) ContainsCode(hd Header) bool {
 	if p.Code != hd.ProjectCode {
 		return false
@@ -236,6 +395,9 @@ func (p Project) ContainsCode(hd Header) bool {
 	if len(equip) == 0 {
 		return false
 	}
+	if _, ok := p.serialRange(equip); ok {
+		return true
+	}
 	for _, sys := range p.Systems {
 		if equip[0] == sys.Code {
 			return sys.contains(equip)
@@ -0,0 +1,33 @@
+package qap
+
+import "testing"
+
+func TestProjectEquipmentHierarchy(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MVR", "MVRA", "MVRAX", "MVRAY", "MVRB"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatalf("adding %q: %s", code, err)
+		}
+	}
+	for _, code := range []string{"", "MVRAXZ", "MVRC1", "mv", "MVRAX", "MVRCX", "MXR", "MVRBZZ"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err == nil {
+			t.Errorf("expected error adding %q", code)
+		}
+	}
+	models := p.Systems[0].Families[0].Types[0].Models
+	if len(models) != 2 || len(models[0].Variants) != 2 || models[0].Variants[1].Code != 'Y' {
+		t.Errorf("unexpected models %+v", models)
+	}
+	for code, expect := range map[string]bool{
+		"M": true, "MVRA": true, "MVRAY": true, "MVRB": true,
+		"MVRAZ": false, "MVRC": false, "MVRBX": false, "X": false,
+	} {
+		hd, err := ParseHeader("LHC-"+code+"-QA-001.00", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ContainsCode(hd) != expect {
+			t.Errorf("expected ContainsCode(%s) == %t", hd, expect)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package qap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Querier is implemented by HeaderFilter and SyncHeaderFilter. It is
+// used to find the headers affected by changes to a project structure.
+type Querier interface {
+	Query(q Query) *QueryIterator
+}
+
+// Impact reports the effect of a project structure change on existing documents.
+type Impact struct {
+	// Uncovered are the headers contained in the structure before the
+	// change and not contained after it. See Project.ContainsCode.
+	Uncovered []Header
+}
+
+// Orphans reports whether the change leaves documents outside the project structure.
+func (im Impact) Orphans() bool { return len(im.Uncovered) > 0 }
+
+func (im Impact) String() string {
+	if !im.Orphans() {
+		return "no documents affected"
+	}
+	const maxListed = 5
+	names := make([]string, 0, maxListed)
+	for i := 0; i < len(im.Uncovered) && i < maxListed; i++ {
+		names = append(names, im.Uncovered[i].String())
+	}
+	if len(im.Uncovered) > maxListed {
+		names = append(names, "...")
+	}
+	return fmt.Sprintf("%d documents no longer covered by structure: %s", len(im.Uncovered), strings.Join(names, ", "))
+}
+
+// RenameNode changes the name and description of the equipment structure node
+// with the given code i.e. "MV" for a family. Empty arguments leave the
+// corresponding field unchanged. Renaming never uncovers documents.
+func (p *Project) RenameNode(code, name, description string) error {
+	n, err := p.node(code)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		*n.name = name
+	}
+	if description != "" {
+		*n.desc = description
+	}
+	return nil
+}
+
+// RecodeNode changes the last letter of the code of the node with the given
+// code to newCode, i.e. recoding "MV" with 'X' turns family "MV" into "MX"
+// along with all of its types, models and variants. The headers in headers
+// that are no longer covered by the structure are reported in the returned Impact.
+// headers may be nil in which case no impact is reported.
+func (p *Project) RecodeNode(headers Querier, code string, newCode byte) (Impact, error) {
+	n, err := p.node(code)
+	if err != nil {
+		return Impact{}, err
+	}
+	if !isAlphaNum(newCode) {
+		return Impact{}, ErrBadEquipmentCode
+	}
+	if newCode == *n.code {
+		return Impact{}, nil
+	}
+	recoded := code[:len(code)-1] + string(newCode)
+	if _, err := p.node(recoded); err == nil {
+		return Impact{}, fmt.Errorf("equipment code %s already exists", recoded)
+	}
+	if err := p.checkRekeySerials(code, recoded); err != nil {
+		return Impact{}, err
+	}
+	return p.edit(headers, code, func(cp *Project) error {
+		n, err := cp.node(code)
+		if err != nil {
+			return err
+		}
+		*n.code = newCode
+		cp.rekey(code, recoded)
+		return nil
+	})
+}
+
+// MoveNode moves the node with the given code and its children under the node
+// with code parent, i.e. moving family "MV" under system "X" turns it into
+// family "XV". Systems have no parent and can not be moved. See RecodeNode
+// for the meaning of headers and Impact.
+func (p *Project) MoveNode(headers Querier, code, parent string) (Impact, error) {
+	if len(code) < 2 {
+		return Impact{}, errors.New("systems can not be moved, recode them instead")
+	}
+	if len(parent) != len(code)-1 {
+		return Impact{}, fmt.Errorf("node %s must be moved under a node of %d letters", code, len(code)-1)
+	}
+	if parent == code[:len(code)-1] {
+		return Impact{}, nil
+	}
+	if _, err := p.node(parent); err != nil {
+		return Impact{}, err
+	}
+	n, err := p.node(code)
+	if err != nil {
+		return Impact{}, err
+	}
+	movedCode := parent + string(*n.code)
+	if _, err := p.node(movedCode); err == nil {
+		return Impact{}, fmt.Errorf("equipment code %s already exists", movedCode)
+	}
+	if err := p.checkRekeySerials(code, movedCode); err != nil {
+		return Impact{}, err
+	}
+	return p.edit(headers, code, func(cp *Project) error {
+		cp.rekey(code, movedCode)
+		moved := cp.remove(code)
+		switch v := moved.(type) {
+		case Family:
+			return cp.AddFamily(parent[0], v)
+		case Type:
+			return cp.AddType(parent[0], parent[1], v)
+		case Model:
+			return cp.AddModel(parent[0], parent[1], parent[2], v)
+		case Variant:
+			return cp.AddVariant(parent[0], parent[1], parent[2], parent[3], v)
+		}
+		return errors.New("unreachable")
+	})
+}
+
+// DeleteNode deletes the node with the given code along with its children.
+// See RecodeNode for the meaning of headers and Impact.
+func (p *Project) DeleteNode(headers Querier, code string) (Impact, error) {
+	if _, err := p.node(code); err != nil {
+		return Impact{}, err
+	}
+	return p.edit(headers, code, func(cp *Project) error {
+		cp.remove(code)
+		cp.rekey(code, "")
+		return nil
+	})
+}
+
+// rekey replaces the equipment code prefix from with to in the serial ranges
+// and document type rules under the node from. If to is empty they are removed.
+func (p *Project) rekey(from, to string) {
+	p.rekeySerials(from, to)
+	p.rekeyDocumentTypeRules(from, to)
+}
+
+// edit applies the change to a copy of the structure which replaces the
+// structure only if the change succeeds, so that failed changes leave the
+// structure untouched. It reports the headers under the node with the given
+// code that were covered before the change and are not after it.
+func (p *Project) edit(headers Querier, code string, change func(cp *Project) error) (Impact, error) {
+	var covered []Header
+	if headers != nil {
+		q, err := ParseQuery(p.Project() + "-" + code + "*")
+		if err != nil {
+			return Impact{}, err
+		}
+		it := headers.Query(q)
+		buf := make([]Header, 64)
+		for {
+			n, cursor := it.Next(buf)
+			for _, hd := range buf[:n] {
+				if p.ContainsCode(hd) {
+					covered = append(covered, hd)
+				}
+			}
+			if cursor.IsZero() {
+				break
+			}
+		}
+	}
+	cp := p.clone()
+	if err := change(&cp); err != nil {
+		return Impact{}, err
+	}
+	var impact Impact
+	for _, hd := range covered {
+		if !cp.ContainsCode(hd) {
+			impact.Uncovered = append(impact.Uncovered, hd)
+		}
+	}
+	*p = cp
+	return impact, nil
+}
+
+// structureNode points to the fields of a node in a project's equipment structure.
+type structureNode struct {
+	code       *byte
+	name, desc *string
+}
+
+// node returns the node of the equipment structure with the given code.
+func (p *Project) node(code string) (structureNode, error) {
+	if len(code) == 0 || len(code) > lenE || validQAPAlphanum([]byte(code)) != code {
+		return structureNode{}, ErrBadEquipmentCode
+	}
+	notFound := fmt.Errorf("equipment code %s not found in project %s", code, p)
+	sys := p.system(code[0])
+	if sys == nil {
+		return structureNode{}, notFound
+	} else if len(code) == 1 {
+		return structureNode{&sys.Code, &sys.Name, &sys.Description}, nil
+	}
+	fam := sys.family(code[1])
+	if fam == nil {
+		return structureNode{}, notFound
+	} else if len(code) == 2 {
+		return structureNode{&fam.Code, &fam.Name, &fam.Description}, nil
+	}
+	tp := fam.typ(code[2])
+	if tp == nil {
+		return structureNode{}, notFound
+	} else if len(code) == 3 {
+		return structureNode{&tp.Code, &tp.Name, &tp.Description}, nil
+	}
+	model := tp.model(code[3])
+	if model == nil {
+		return structureNode{}, notFound
+	} else if len(code) == 4 {
+		return structureNode{&model.Code, &model.Name, &model.Description}, nil
+	}
+	variant := model.variant(code[4])
+	if variant == nil {
+		return structureNode{}, notFound
+	}
+	return structureNode{&variant.Code, &variant.Name, &variant.Description}, nil
+}
+
+// remove removes the existing node with the given code from the
+// structure and returns it. Its type depends on the length of code.
+func (p *Project) remove(code string) (removed interface{}) {
+	if len(code) == 1 {
+		for i := range p.Systems {
+			if p.Systems[i].Code == code[0] {
+				removed = p.Systems[i]
+				p.Systems = append(p.Systems[:i], p.Systems[i+1:]...)
+				break
+			}
+		}
+		return removed
+	}
+	sys := p.system(code[0])
+	if len(code) == 2 {
+		for i := range sys.Families {
+			if sys.Families[i].Code == code[1] {
+				removed = sys.Families[i]
+				sys.Families = append(sys.Families[:i], sys.Families[i+1:]...)
+				break
+			}
+		}
+		return removed
+	}
+	fam := sys.family(code[1])
+	if len(code) == 3 {
+		for i := range fam.Types {
+			if fam.Types[i].Code == code[2] {
+				removed = fam.Types[i]
+				fam.Types = append(fam.Types[:i], fam.Types[i+1:]...)
+				break
+			}
+		}
+		return removed
+	}
+	tp := fam.typ(code[2])
+	if len(code) == 4 {
+		for i := range tp.Models {
+			if tp.Models[i].Code == code[3] {
+				removed = tp.Models[i]
+				tp.Models = append(tp.Models[:i], tp.Models[i+1:]...)
+				break
+			}
+		}
+		return removed
+	}
+	model := tp.model(code[3])
+	for i := range model.Variants {
+		if model.Variants[i].Code == code[4] {
+			removed = model.Variants[i]
+			model.Variants = append(model.Variants[:i], model.Variants[i+1:]...)
+			break
+		}
+	}
+	return removed
+}
+
+func (p *Project) system(code byte) *System {
+	for i := range p.Systems {
+		if p.Systems[i].Code == code {
+			return &p.Systems[i]
+		}
+	}
+	return nil
+}
+
+func (s *System) family(code byte) *Family {
+	for i := range s.Families {
+		if s.Families[i].Code == code {
+			return &s.Families[i]
+		}
+	}
+	return nil
+}
+
+func (f *Family) typ(code byte) *Type {
+	for i := range f.Types {
+		if f.Types[i].Code == code {
+			return &f.Types[i]
+		}
+	}
+	return nil
+}
+
+func (t *Type) model(code byte) *Model {
+	for i := range t.Models {
+		if t.Models[i].Code == code {
+			return &t.Models[i]
+		}
+	}
+	return nil
+}
+
+func (m *Model) variant(code byte) *Variant {
+	for i := range m.Variants {
+		if m.Variants[i].Code == code {
+			return &m.Variants[i]
+		}
+	}
+	return nil
+}
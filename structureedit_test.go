@@ -0,0 +1,135 @@
+package qap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProjectEditNodes(t *testing.T) {
+	var headers []Header
+	for _, name := range []string{"LHC-MVR-QA-001.00", "LHC-MVRA-QA-002.00", "LHC-MB-QA-003.00", "LHC-XA-QA-004.00", "SPS-MVR-QA-001.00"} {
+		hd, err := ParseHeader(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, hd)
+	}
+	hf := NewHeaderFilter(headers)
+	for _, test := range []struct {
+		desc      string
+		edit      func(p *Project) (Impact, error)
+		uncovered int
+		contains  []string
+		missing   []string
+	}{
+		{
+			desc:      "delete type",
+			edit:      func(p *Project) (Impact, error) { return p.DeleteNode(&hf, "MVR") },
+			uncovered: 2,
+			contains:  []string{"MV", "MB"},
+			missing:   []string{"MVR", "MVRA"},
+		},
+		{
+			desc:     "delete model without filter",
+			edit:     func(p *Project) (Impact, error) { return p.DeleteNode(nil, "MVRA") },
+			contains: []string{"MVR"},
+			missing:  []string{"MVRA"},
+		},
+		{
+			desc:      "recode family",
+			edit:      func(p *Project) (Impact, error) { return p.RecodeNode(&hf, "MV", 'W') },
+			uncovered: 2,
+			contains:  []string{"MW", "MWR", "MWRA"},
+			missing:   []string{"MV"},
+		},
+		{
+			desc:      "move family",
+			edit:      func(p *Project) (Impact, error) { return p.MoveNode(NewSyncHeaderFilter(headers), "MV", "X") },
+			uncovered: 2,
+			contains:  []string{"XV", "XVR", "XVRA", "XA", "MB"},
+			missing:   []string{"MV"},
+		},
+		{
+			desc:     "move unused type",
+			edit:     func(p *Project) (Impact, error) { return p.MoveNode(&hf, "MBZ", "XA") },
+			contains: []string{"XAZ", "MB"},
+			missing:  []string{"MBZ"},
+		},
+	} {
+		p := Project{Code: [4]byte{'L', 'H', 'C'}}
+		for _, code := range []string{"M", "MV", "MVR", "MVRA", "MB", "MBZ", "X", "XA"} {
+			if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		impact, err := test.edit(&p)
+		if err != nil {
+			t.Errorf("%s: %s", test.desc, err)
+			continue
+		}
+		if len(impact.Uncovered) != test.uncovered {
+			t.Errorf("%s: expected %d uncovered headers, got %s", test.desc, test.uncovered, impact)
+		}
+		for _, code := range test.contains {
+			if _, err := p.node(code); err != nil {
+				t.Errorf("%s: %s", test.desc, err)
+			}
+		}
+		for _, code := range test.missing {
+			if _, err := p.node(code); err == nil {
+				t.Errorf("%s: expected %s to be removed", test.desc, code)
+			}
+		}
+	}
+}
+
+func TestProjectEditNodesErrors(t *testing.T) {
+	p := Project{Code: [4]byte{'L', 'H', 'C'}}
+	for _, code := range []string{"M", "MV", "MB", "X", "XV"} {
+		if err := p.AddEquipmentCode(code, "name", "desc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.RenameNode("MV", "Vacuum", ""); err != nil {
+		t.Fatal(err)
+	}
+	if p.Systems[0].Families[0].Name != "Vacuum" || p.Systems[0].Families[0].Description != "desc" {
+		t.Errorf("unexpected renamed family %+v", p.Systems[0].Families[0])
+	}
+	if err := p.RenameNode("MZ", "name", ""); err == nil {
+		t.Error("expected error renaming absent node")
+	}
+	if _, err := p.RecodeNode(nil, "MV", 'B'); err == nil {
+		t.Error("expected error recoding to existing code")
+	}
+	if _, err := p.MoveNode(nil, "MV", "X"); err == nil {
+		t.Error("expected error moving onto existing code")
+	}
+	if _, err := p.MoveNode(nil, "M", ""); err == nil {
+		t.Error("expected error moving system")
+	}
+	if _, err := p.MoveNode(nil, "MB", "XV"); err == nil {
+		t.Error("expected error moving under node of wrong level")
+	}
+	if _, err := p.DeleteNode(nil, "Q"); err == nil {
+		t.Error("expected error deleting absent node")
+	}
+	// Failed changes leave the structure untouched.
+	if err := p.RestrictDocumentTypes("MV", "DR"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.edit(nil, "MV", func(cp *Project) error {
+		cp.remove("MV")
+		cp.rekey("MV", "")
+		return errors.New("failed change")
+	})
+	if err == nil {
+		t.Fatal("expected error from failed change")
+	}
+	if _, err := p.node("MV"); err != nil {
+		t.Errorf("expected node kept after failed change: %s", err)
+	}
+	if len(p.DocumentTypeRules) != 1 {
+		t.Errorf("expected document type rule kept after failed change, got %v", p.DocumentTypeRules)
+	}
+}
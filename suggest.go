@@ -0,0 +1,132 @@
+package qap
+
+import (
+	"sort"
+	"strings"
+)
+
+// Suggestion is a corrected query offered for a query with misspelled codes.
+type Suggestion struct {
+	// Query is the query with its codes corrected.
+	Query string
+	// Distance is the edit distance between the original and corrected codes.
+	Distance int
+	// Count is the amount of headers in the filter with the corrected codes.
+	Count int
+}
+
+// Suggest returns up to n "did you mean" suggestions for query ranked by
+// the edit distance between the codes of the query's first code term and
+// the project, equipment and document type codes present in the filter.
+// Codes omitted in the query are not taken into account. Terms with
+// wildcards are not corrected. Suggest returns no suggestions if the query's
+// codes are present in the filter or if no codes in the filter are
+// sufficiently similar to those in query.
+func (hf *HeaderFilter) Suggest(query string, n int) []Suggestion {
+	terms := strings.Split(query, " ")
+	termIdx := -1
+	var parts []string
+	for i, term := range terms {
+		if term == "" || strings.ContainsAny(term, "!#.:*?|") && !isHeaderLike(term) {
+			continue
+		}
+		termIdx = i
+		parts = strings.SplitN(term, "-", 4)
+		break
+	}
+	if termIdx < 0 || n <= 0 {
+		return nil
+	}
+	ncodes := len(parts)
+	if ncodes > 3 {
+		ncodes = 3
+	}
+	queryLen := 0
+	for _, part := range parts[:ncodes] {
+		queryLen += len(part)
+	}
+	maxDist := 1 + queryLen/4
+	found := make(map[string]*Suggestion)
+	for key, count := range hf.codes {
+		codes := [3]string{codeString(key[:capP]), codeString(key[capP : capP+capE]), codeString(key[capP+capE:])}
+		dist := 0
+		for i := 0; i < ncodes; i++ {
+			dist += editDistance(parts[i], codes[i])
+		}
+		if dist == 0 {
+			return nil // Codes are correct.
+		}
+		if dist > maxDist {
+			continue
+		}
+		corrected := append(codes[:ncodes:ncodes], parts[ncodes:]...)
+		terms[termIdx] = strings.Join(corrected, "-")
+		suggested := strings.Join(terms, " ")
+		if s, ok := found[suggested]; ok {
+			s.Count += count
+			continue
+		}
+		found[suggested] = &Suggestion{Query: suggested, Distance: dist, Count: count}
+	}
+	suggestions := make([]Suggestion, 0, len(found))
+	for _, s := range found {
+		suggestions = append(suggestions, *s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		switch {
+		case a.Distance != b.Distance:
+			return a.Distance < b.Distance
+		case a.Count != b.Count:
+			return a.Count > b.Count
+		}
+		return a.Query < b.Query
+	})
+	if len(suggestions) > n {
+		suggestions = suggestions[:n]
+	}
+	return suggestions
+}
+
+// isHeaderLike reports whether term is a code term with a document number
+// and attachment number i.e. "LHC-PM-QA-202.00".
+func isHeaderLike(term string) bool {
+	return strings.Count(term, "-") == 3 && !strings.ContainsAny(term, "!#:*?|")
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b, which is the Levenshtein distance with transpositions of adjacent
+// characters counting as a single edit.
+func editDistance(a, b string) int {
+	// d[i][j] is the distance between a[:i] and b[:j].
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(a int, rest ...int) int {
+	for _, v := range rest {
+		if v < a {
+			a = v
+		}
+	}
+	return a
+}
@@ -0,0 +1,58 @@
+package qap
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	var headers []Header
+	for _, name := range []string{"LHC-PM-QA-202.00", "LHC-PM-QA-203.00", "LHC-PM-DR-001.00", "SPS-PEC-HP-001.00", "LHC-PEC-QA-001.00"} {
+		hd, err := ParseHeader(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, hd)
+	}
+	hf := NewHeaderFilter(headers)
+	for _, test := range []struct {
+		Query  string
+		Expect []string
+	}{
+		{Query: "LCH-PM-QA-202", Expect: []string{"LHC-PM-QA-202"}},
+		{Query: "LCH", Expect: []string{"LHC"}},
+		{Query: "SPS-PCE .00", Expect: []string{"SPS-PEC .00"}},
+		{Query: "LHC-PM-QA-999"},
+		{Query: "XYZ-ABC-DE"},
+		{Query: "LHC-P*"},
+	} {
+		got := hf.Suggest(test.Query, 2)
+		if len(got) != len(test.Expect) {
+			t.Errorf("query %q: expected suggestions %v, got %v", test.Query, test.Expect, got)
+			continue
+		}
+		for i := range got {
+			if got[i].Query != test.Expect[i] {
+				t.Errorf("query %q: expected suggestions %v, got %v", test.Query, test.Expect, got)
+				break
+			}
+		}
+	}
+	if got := hf.Suggest("LCH", 1); len(got) != 1 || got[0].Count != 4 {
+		t.Errorf("expected LHC suggestion to count 4 headers, got %v", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		A, B   string
+		Expect int
+	}{
+		{"LHC", "LHC", 0},
+		{"LCH", "LHC", 1},
+		{"PM", "PEM", 1},
+		{"", "QA", 2},
+		{"MAG", "MBX", 2},
+	} {
+		if got := editDistance(test.A, test.B); got != test.Expect {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.A, test.B, got, test.Expect)
+		}
+	}
+}
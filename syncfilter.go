@@ -0,0 +1,181 @@
+package qap
+
+import "sync"
+
+// SyncHeaderFilter is a HeaderFilter safe for concurrent use by multiple
+// goroutines. Queries may run concurrently with each other while
+// modifications to the filter are exclusive.
+type SyncHeaderFilter struct {
+	mu sync.RWMutex
+	hf HeaderFilter
+}
+
+// NewSyncHeaderFilter initializes a SyncHeaderFilter with headers data.
+func NewSyncHeaderFilter(headers []Header) *SyncHeaderFilter {
+	return &SyncHeaderFilter{hf: NewHeaderFilter(headers)}
+}
+
+// Len returns the amount of headers contained in filter.
+func (sf *SyncHeaderFilter) Len() int {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Len()
+}
+
+// Tombstones returns the amount of removed headers still taking up space
+// in the filter. See Compact.
+func (sf *SyncHeaderFilter) Tombstones() int {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Tombstones()
+}
+
+// AddHeader adds a header to the filter.
+func (sf *SyncHeaderFilter) AddHeader(h Header) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.AddHeader(h)
+}
+
+// AddHeaders adds headers to the filter in a single batch.
+// See HeaderFilter.AddHeaders.
+func (sf *SyncHeaderFilter) AddHeaders(headers []Header) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.AddHeaders(headers)
+}
+
+// Remove removes the header h from the filter. See HeaderFilter.Remove.
+func (sf *SyncHeaderFilter) Remove(h Header) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.Remove(h)
+}
+
+// Replace replaces the header old with new. See HeaderFilter.Replace.
+func (sf *SyncHeaderFilter) Replace(old, new Header) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.Replace(old, new)
+}
+
+// Retire marks the number of the main document header h as used.
+// See HeaderFilter.Retire.
+func (sf *SyncHeaderFilter) Retire(h Header) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.Retire(h)
+}
+
+// Compact reclaims the space taken up by removed headers. See HeaderFilter.Compact.
+func (sf *SyncHeaderFilter) Compact() {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.hf.Compact()
+}
+
+// SetNumberingPolicy sets the numbering policy of project.
+// See HeaderFilter.SetNumberingPolicy.
+func (sf *SyncHeaderFilter) SetNumberingPolicy(project string, policy NumberingPolicy) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.SetNumberingPolicy(project, policy)
+}
+
+// NextNumber returns the number to be given to a new document with the given
+// codes. See HeaderFilter.NextNumber. The number may be taken by another
+// goroutine before it is used; use AddNextNumber to allocate numbers.
+func (sf *SyncHeaderFilter) NextNumber(project, equipment, docType string) (int32, error) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.NextNumber(project, equipment, docType)
+}
+
+// AddNextNumber allocates the next document number for the given codes and
+// adds the resulting header to the filter in a single step so that concurrent
+// callers are never given the same number. See HeaderFilter.AddNextNumber.
+func (sf *SyncHeaderFilter) AddNextNumber(project, equipment, docType string) (Header, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.AddNextNumber(project, equipment, docType)
+}
+
+// HumanQuery queries filter for n matches which are stored in dst. The total
+// amount of matches found is totalFound. See HeaderFilter.HumanQuery.
+func (sf *SyncHeaderFilter) HumanQuery(dst []Header, query string, page int) (n, totalFound int) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.HumanQuery(dst, query, page)
+}
+
+// Search queries filter for headers matching q. See HeaderFilter.Search.
+func (sf *SyncHeaderFilter) Search(dst []Header, q Query, page int) (n, totalFound int) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Search(dst, q, page)
+}
+
+// Suggest returns up to n suggestions for a query with misspelled codes.
+// See HeaderFilter.Suggest.
+func (sf *SyncHeaderFilter) Suggest(query string, n int) []Suggestion {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Suggest(query, n)
+}
+
+// Facets counts headers matching q. See HeaderFilter.Facets.
+func (sf *SyncHeaderFilter) Facets(q Query, equipmentPrefix int) Facets {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Facets(q, equipmentPrefix)
+}
+
+// Query returns an iterator over the headers in the filter matching q.
+// The filter is locked for reading during each call to the iterator's Next
+// method so the filter may be modified between calls. See HeaderFilter.Query.
+func (sf *SyncHeaderFilter) Query(q Query) *QueryIterator {
+	it := sf.hf.Query(q)
+	it.lock = sf.mu.RLocker()
+	return it
+}
+
+// MarshalBinary returns a snapshot of the headers in the filter.
+// See HeaderFilter.MarshalBinary.
+func (sf *SyncHeaderFilter) MarshalBinary() ([]byte, error) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.MarshalBinary()
+}
+
+// UnmarshalBinary replaces the headers in the filter with those of a snapshot
+// returned by MarshalBinary. See HeaderFilter.UnmarshalBinary.
+func (sf *SyncHeaderFilter) UnmarshalBinary(data []byte) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.hf.UnmarshalBinary(data)
+}
+
+// Has reports whether the filter contains the header h.
+func (sf *SyncHeaderFilter) Has(h Header) bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Has(h)
+}
+
+// Do calls f for every header in the filter. See HeaderFilter.Do.
+// The filter is locked for reading during iteration so f must not
+// modify the filter.
+func (sf *SyncHeaderFilter) Do(f func(i int, h Header) error) error {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.Do(f)
+}
+
+// DoCodes calls f for every header in the filter with the same codes as h.
+// See HeaderFilter.DoCodes. The filter is locked for reading during
+// iteration so f must not modify the filter.
+func (sf *SyncHeaderFilter) DoCodes(h Header, f func(i int, h Header) error) error {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hf.DoCodes(h, f)
+}
@@ -0,0 +1,58 @@
+package qap
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSyncHeaderFilterConcurrent(t *testing.T) {
+	headers := randomHeaders(rand.New(rand.NewSource(3)), 4000)
+	sf := NewSyncHeaderFilter(headers[:1000])
+	var wg sync.WaitGroup
+	const writers = 4
+	chunk := (len(headers) - 1000) / writers
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(added []Header) {
+			defer wg.Done()
+			for i, hd := range added {
+				if err := sf.AddHeader(hd); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%10 == 0 {
+					if err := sf.Remove(hd); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(headers[1000+w*chunk : 1000+(w+1)*chunk])
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			dst := make([]Header, 40)
+			for i := 0; i < 200; i++ {
+				sf.HumanQuery(dst, []string{"LHC", "SPS-M", "QA", "AWA-MB-DR"}[i%4], i%3)
+				sf.Has(headers[(r*200+i)%len(headers)])
+				sf.DoCodes(headers[i], func(int, Header) error { return nil })
+				if i%50 == 0 {
+					sf.Compact()
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+	expect := 1000
+	for _, hd := range headers[1000:] {
+		if sf.Has(hd) {
+			expect++
+		}
+	}
+	if sf.Len() != expect || expect != len(headers)-(len(headers)-1000)/10 {
+		t.Errorf("expected %d headers in filter, got %d", expect, sf.Len())
+	}
+}